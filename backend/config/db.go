@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"fp-pbkk/models"
 
@@ -20,23 +21,181 @@ func ConnectDB() {
 	port := os.Getenv("DB_PORT")
 	name := os.Getenv("DB_NAME")
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC",
 		user, pass, host, port, name,
 	)
 
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// Timestamps are stored in UTC; day boundaries are worked out in each user's zone.
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
 		log.Fatal("Failed to connect to DB: ", err)
 	}
 
 	DB = db
 
-	db.AutoMigrate(
+	// The unique (user, date) index cannot be created while a day exists twice.
+	if err := dedupeIntakes(db); err != nil {
+		log.Fatal("Failed to merge duplicate daily intakes: ", err)
+	}
+	// Likewise the unique (meal, version) index of the meal history.
+	if err := renumberMealVersions(db); err != nil {
+		log.Fatal("Failed to renumber meal versions: ", err)
+	}
+
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.DailyIntake{},
 		&models.Meal{},
+		&models.MealVersion{},
 		&models.Comment{},
-	)
+		&models.CommentRead{},
+		&models.DirectMessage{},
+		&models.Notification{},
+		&models.EmailJob{},
+		&models.PasswordReset{},
+		&models.RecoveryCode{},
+		&models.LoginThrottle{},
+		&models.WeightLog{},
+		&models.ClientAssignment{},
+		&models.MealPlan{},
+		&models.PlannedMeal{},
+		&models.UnlockRequest{},
+		&models.UnlockTransition{},
+		&models.JobRun{},
+		&models.AuditLog{},
+	); err != nil {
+		log.Fatal("Failed to migrate DB: ", err)
+	}
+
+	// Comments from before threads were always written by a nutritionist.
+	db.Unscoped().Model(&models.Comment{}).
+		Where("C_AuthorID IS NULL OR C_AuthorID = ''").
+		Updates(map[string]interface{}{
+			"C_AuthorID":   gorm.Expr("NutritionistUsers_U_ID"),
+			"C_AuthorRole": "Nutritionist",
+		})
 
 	fmt.Println("Database connected!")
 }
+
+// dedupeIntakes merges days stored more than once for the same user and date,
+// left from before the (user, date) unique index, into one row each. Meals,
+// comments and unlock requests move to the kept row; the day stays locked if any
+// copy was locked and its total is recomputed.
+//
+// It runs before AutoMigrate, so on a database from before the index, which is
+// the only kind that has duplicates, tables and columns added since may be
+// missing; each step checks for what it touches.
+func dedupeIntakes(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.DailyIntake{}) {
+		return nil
+	}
+
+	children := []interface{}{&models.Meal{}, &models.Comment{}}
+	if migrator.HasTable(&models.UnlockRequest{}) {
+		children = append(children, &models.UnlockRequest{})
+	}
+	hasReads := migrator.HasTable(&models.CommentRead{})
+	hasMealDeletedAt := migrator.HasColumn(&models.Meal{}, "DeletedAt")
+	hasVersion := migrator.HasColumn(&models.DailyIntake{}, "DIVersion")
+
+	var groups []struct {
+		UserID string
+		Date   time.Time
+		Keep   string
+		Locked bool
+	}
+	if err := db.Model(&models.DailyIntake{}).
+		Select("CustomerUsers_U_ID AS user_id, DI_Date AS date, MIN(DI_ID) AS keep, MAX(DI_isLocked) AS locked").
+		Group("CustomerUsers_U_ID, DI_Date").
+		Having("COUNT(*) > 1").
+		Scan(&groups).Error; err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		var dupes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.DailyIntake{}).
+				Where("CustomerUsers_U_ID = ? AND DI_Date = ? AND DI_ID <> ?", g.UserID, g.Date, g.Keep).
+				Pluck("DI_ID", &dupes).Error; err != nil {
+				return err
+			}
+
+			for _, model := range children {
+				if err := tx.Unscoped().Model(model).
+					Where("Daily_Intakes_DI_ID IN ?", dupes).
+					UpdateColumn("Daily_Intakes_DI_ID", g.Keep).Error; err != nil {
+					return err
+				}
+			}
+			// Read markers are unique per day and user; dropping them only makes
+			// comments show as unread again.
+			if hasReads {
+				if err := tx.Where("Daily_Intakes_DI_ID IN ?", dupes).Delete(&models.CommentRead{}).Error; err != nil {
+					return err
+				}
+			}
+
+			meals := tx.Unscoped().Model(&models.Meal{}).Where("Daily_Intakes_DI_ID = ?", g.Keep)
+			if hasMealDeletedAt {
+				meals = meals.Where("M_DeletedAt IS NULL")
+			}
+			var total int
+			if err := meals.Select("COALESCE(SUM(M_Calories), 0)").Scan(&total).Error; err != nil {
+				return err
+			}
+
+			updates := map[string]interface{}{
+				"DI_TotalCalories": total,
+				"DI_isLocked":      g.Locked,
+			}
+			if hasVersion {
+				updates["DI_Version"] = gorm.Expr("DI_Version + 1")
+			}
+			if err := tx.Model(&models.DailyIntake{}).Where("DI_ID = ?", g.Keep).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+
+			return tx.Where("DI_ID IN ?", dupes).Delete(&models.DailyIntake{}).Error
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("merged %d duplicate days of user %s on %s", len(dupes), g.UserID, g.Date.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// renumberMealVersions numbers the history of every meal that has two snapshots
+// with the same version 1, 2, 3, … in the order they were taken.
+func renumberMealVersions(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.MealVersion{}) {
+		return nil
+	}
+
+	var mealIDs []string
+	if err := db.Model(&models.MealVersion{}).
+		Group("Meals_M_ID, MV_Version").
+		Having("COUNT(*) > 1").
+		Distinct().
+		Pluck("Meals_M_ID", &mealIDs).Error; err != nil {
+		return err
+	}
+
+	for _, mealID := range mealIDs {
+		var ids []uint
+		if err := db.Model(&models.MealVersion{}).Where("Meals_M_ID = ?", mealID).Order("MV_ID").Pluck("MV_ID", &ids).Error; err != nil {
+			return err
+		}
+		for i, id := range ids {
+			if err := db.Model(&models.MealVersion{}).Where("MV_ID = ?", id).Update("MV_Version", i+1).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvInt reads an integer setting from the environment, falling back to def when unset or invalid.
+func EnvInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// EnvBool reads a true/false setting from the environment, falling back to def when unset or invalid.
+func EnvBool(key string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// AllowedOrigins are the browser origins the API answers to: the CORS allow-list,
+// also checked when a WebSocket is opened. Set CORS_ORIGINS to a comma-separated
+// list; the default is the local frontend.
+func AllowedOrigins() []string {
+	list := os.Getenv("CORS_ORIGINS")
+	if list == "" {
+		return []string{"http://localhost:3000"}
+	}
+
+	var origins []string
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// TrustedProxies are the proxies whose X-Forwarded-For header is believed, from
+// the comma-separated TRUSTED_PROXIES; none by default.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// TwoFactorRequired is true for roles that may not log in or stay logged in
+// without 2FA: nutritionists while TOTP_REQUIRED_FOR_NUTRITIONISTS is set.
+func TwoFactorRequired(role string) bool {
+	return role == "Nutritionist" && EnvBool("TOTP_REQUIRED_FOR_NUTRITIONISTS", false)
+}
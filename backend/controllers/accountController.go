@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DELETE /account
+// Deactivates the account right away; the purge job erases it after the cooling-off period.
+func DeleteAccount(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	var input struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password confirmation required"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("U_ID = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+		return
+	}
+
+	now := time.Now()
+	purgeAfter := now.AddDate(0, 0, config.EnvInt("ACCOUNT_COOLING_OFF_DAYS", 14))
+	if err := config.DB.Model(&user).Updates(map[string]interface{}{
+		"U_DeactivatedAt": now,
+		"U_PurgeAfter":    purgeAfter,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	recordAudit(c, "deactivate", "user", user.UID, user.UID, nil, gin.H{"purge_after": purgeAfter})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Account deactivated. It will be permanently deleted after the cooling-off period unless restored.",
+		"purge_after": purgeAfter,
+	})
+}
+
+// POST /account/restore
+// Public, because a deactivated account can no longer log in.
+func RestoreAccount(c *gin.Context) {
+	var input LoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := checkCredentials(c, input)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not scheduled for deletion"})
+		return
+	}
+	if user.PurgeAfter != nil && time.Now().After(*user.PurgeAfter) {
+		c.JSON(http.StatusGone, gin.H{"error": "Cooling-off period is over"})
+		return
+	}
+
+	if err := config.DB.Model(&user).Updates(map[string]interface{}{
+		"U_DeactivatedAt": nil,
+		"U_PurgeAfter":    nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+
+	c.Set("user_id", user.UID)
+	c.Set("role", user.Role)
+	recordAudit(c, "restore", "user", user.UID, user.UID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored, you can log in again"})
+}
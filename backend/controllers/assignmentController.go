@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/events"
+	"fp-pbkk/models"
+	"fp-pbkk/notify"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// isAssignedNutritionist reports whether the client has accepted the nutritionist.
+func isAssignedNutritionist(nutritionistID string, userID string) bool {
+	var count int64
+	config.DB.Model(&models.ClientAssignment{}).Scopes(models.AcceptedAssignments).
+		Where("NutritionistUsers_U_ID = ? AND CustomerUsers_U_ID = ?", nutritionistID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// AssignClient asks a client to accept the nutritionist. Nothing of the client's
+// is visible to the nutritionist until they do.
+func AssignClient(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	nutritionistID := c.GetString("user_id")
+
+	var input struct {
+		UserID   string `json:"user_id"`
+		Username string `json:"username"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
+		return
+	}
+
+	var client models.User
+	query := config.DB.Where("U_Role = ? AND U_DeactivatedAt IS NULL", "User")
+	if input.UserID != "" {
+		query = query.Where("U_ID = ?", input.UserID)
+	} else if input.Username != "" {
+		query = query.Where("U_Username = ?", input.Username)
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id or username required"})
+		return
+	}
+	if err := query.First(&client).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+
+	assignment := models.ClientAssignment{
+		NutritionistID: nutritionistID,
+		CustomerUserID: client.UID,
+	}
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&assignment)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign client"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		config.DB.Where("NutritionistUsers_U_ID = ? AND CustomerUsers_U_ID = ?", nutritionistID, client.UID).First(&assignment)
+	} else {
+		var me models.User
+		config.DB.Select("U_Username").Where("U_ID = ?", nutritionistID).First(&me)
+
+		events.Publish(events.AssignmentRequested, gin.H{"ca_id": assignment.CAID, "nutritionist_id": nutritionistID, "user_id": client.UID}, client.UID)
+		notify.Send(models.Notification{
+			UserID: client.UID,
+			NType:  notify.AssignmentRequested,
+			NTitle: me.Username + " wants to be your nutritionist",
+			NBody:  "Accept to share your logs with them, or decline.",
+			NLink:  "/dashboard-user/profile",
+			NKey:   notify.Key(notify.AssignmentRequested, strconv.FormatUint(uint64(assignment.CAID), 10)),
+		})
+	}
+
+	message := "Request sent, waiting for the client to accept"
+	if assignment.CAAcceptedAt != nil {
+		message = "Client already assigned"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "data": assignment})
+}
+
+// GetAssignedClients lists the clients who accepted the nutritionist, and the
+// requests still waiting, which only show the client's username.
+func GetAssignedClients(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var assignments []models.ClientAssignment
+	if err := config.DB.
+		Preload("CustomerUser").
+		Scopes(models.AcceptedAssignments).
+		Where("NutritionistUsers_U_ID = ?", c.GetString("user_id")).
+		Find(&assignments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get clients"})
+		return
+	}
+
+	pending := []assignmentSummary{}
+	config.DB.Model(&models.ClientAssignment{}).
+		Select("client_assignments.CA_ID AS ca_id, users.U_ID AS user_id, users.U_Username AS username").
+		Joins("JOIN users ON users.U_ID = client_assignments.CustomerUsers_U_ID").
+		Where("client_assignments.NutritionistUsers_U_ID = ? AND client_assignments.CA_AcceptedAt IS NULL", c.GetString("user_id")).
+		Scan(&pending)
+
+	c.JSON(http.StatusOK, gin.H{"data": assignments, "pending": pending})
+}
+
+// assignmentSummary is what either side sees of the other in an assignment.
+type assignmentSummary struct {
+	CAID       uint       `json:"ca_id"`
+	UserID     string     `json:"user_id"`
+	Username   string     `json:"username"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+// GET /assignments
+// The client's nutritionists and the requests waiting for an answer.
+func GetMyAssignments(c *gin.Context) {
+	var rows []assignmentSummary
+	if err := config.DB.Model(&models.ClientAssignment{}).
+		Select("client_assignments.CA_ID AS ca_id, users.U_ID AS user_id, users.U_Username AS username, client_assignments.CA_AcceptedAt AS accepted_at").
+		Joins("JOIN users ON users.U_ID = client_assignments.NutritionistUsers_U_ID").
+		Where("client_assignments.CustomerUsers_U_ID = ?", c.GetString("user_id")).
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get nutritionists"})
+		return
+	}
+
+	accepted, pending := []assignmentSummary{}, []assignmentSummary{}
+	for _, r := range rows {
+		if r.AcceptedAt != nil {
+			accepted = append(accepted, r)
+		} else {
+			pending = append(pending, r)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": accepted, "pending": pending})
+}
+
+// POST /assignments/:ca_id/accept
+// The client accepts a nutritionist, who can read their logs from then on.
+func AcceptAssignment(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var assignment models.ClientAssignment
+	if err := config.DB.Where("CA_ID = ? AND CustomerUsers_U_ID = ?", c.Param("ca_id"), userID).First(&assignment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+
+	now := time.Now()
+	result := config.DB.Model(&models.ClientAssignment{}).
+		Where("CA_ID = ? AND CA_AcceptedAt IS NULL", assignment.CAID).
+		Update("CA_AcceptedAt", now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept request"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Request already accepted"})
+		return
+	}
+	assignment.CAAcceptedAt = &now
+
+	recordAudit(c, "accept", "client_assignment", strconv.FormatUint(uint64(assignment.CAID), 10), userID, nil, assignment)
+	events.Publish(events.AssignmentAdded, gin.H{"nutritionist_id": assignment.NutritionistID, "user_id": userID}, userID, assignment.NutritionistID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Nutritionist accepted", "data": assignment})
+}
+
+// DELETE /assignments/:ca_id
+// The client declines a request, or ends an accepted assignment.
+func DeclineAssignment(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var assignment models.ClientAssignment
+	if err := config.DB.Where("CA_ID = ? AND CustomerUsers_U_ID = ?", c.Param("ca_id"), userID).First(&assignment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+
+	if err := config.DB.Delete(&assignment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove nutritionist"})
+		return
+	}
+
+	recordAudit(c, "delete", "client_assignment", strconv.FormatUint(uint64(assignment.CAID), 10), userID, assignment, nil)
+	events.Publish(events.AssignmentRemoved, gin.H{"nutritionist_id": assignment.NutritionistID, "user_id": userID}, userID, assignment.NutritionistID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Nutritionist removed"})
+}
+
+func UnassignClient(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := config.DB.
+		Where("NutritionistUsers_U_ID = ? AND CustomerUsers_U_ID = ?", c.GetString("user_id"), c.Param("user_id")).
+		Delete(&models.ClientAssignment{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unassign client"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not assigned"})
+		return
+	}
+
+	events.Publish(events.AssignmentRemoved, gin.H{"nutritionist_id": c.GetString("user_id"), "user_id": c.Param("user_id")},
+		c.Param("user_id"), c.GetString("user_id"))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Client unassigned"})
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit appends who changed what to the audit log. before and after are
+// stored as JSON; pass nil for the side that does not exist (create or delete).
+// A failure is logged but does not fail the request that already succeeded.
+func recordAudit(c *gin.Context, action string, entityType string, entityID string, subjectID string, before interface{}, after interface{}) {
+	entry := models.AuditLog{
+		ActorID:    c.GetString("user_id"),
+		ActorRole:  c.GetString("role"),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		SubjectID:  subjectID,
+		RequestID:  c.GetString("request_id"),
+	}
+	if before != nil {
+		data, _ := json.Marshal(before)
+		entry.Before = string(data)
+	}
+	if after != nil {
+		data, _ := json.Marshal(after)
+		entry.After = string(data)
+	}
+
+	if err := config.DB.Create(&entry).Error; err != nil {
+		log.Printf("audit: could not record %s %s %s: %v", action, entityType, entityID, err)
+	}
+}
+
+// GET /audit?entity_type=&entity_id=&actor_id=&before_id=&limit=
+// Admins see everything; nutritionists see their own actions and their clients' data.
+// The Admin role cannot be registered for; it is granted directly in the database.
+func GetAuditLogs(c *gin.Context) {
+	role := c.GetString("role")
+	userID := c.GetString("user_id")
+	if role != "Nutritionist" && role != "Admin" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	query := config.DB.Model(&models.AuditLog{}).Order("AL_ID DESC")
+
+	if role == "Nutritionist" {
+		clients := config.DB.Model(&models.ClientAssignment{}).Scopes(models.AcceptedAssignments).
+			Select("CustomerUsers_U_ID").
+			Where("NutritionistUsers_U_ID = ?", userID)
+		query = query.Where("AL_ActorID = ? OR AL_SubjectID IN (?)", userID, clients)
+	}
+
+	if v := c.Query("entity_type"); v != "" {
+		query = query.Where("AL_EntityType = ?", v)
+	}
+	if v := c.Query("entity_id"); v != "" {
+		query = query.Where("AL_EntityID = ?", v)
+	}
+	if v := c.Query("actor_id"); v != "" {
+		query = query.Where("AL_ActorID = ?", v)
+	}
+	if v, err := strconv.Atoi(c.Query("before_id")); err == nil {
+		query = query.Where("AL_ID < ?", v)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	var logs []models.AuditLog
+	if err := query.Limit(limit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": logs})
+}
@@ -1,24 +1,34 @@
 package controllers
 
 import (
+	"errors"
 	"fp-pbkk/config"
 	"fp-pbkk/models"
 	"fp-pbkk/utils"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RegisterInput struct {
-	Username string `json:"username" binding:"required"`
+	Username string `json:"username" binding:"required,max=50"`
 	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"required"` // "User" or "Nutritionist"
+	Role     string `json:"role" binding:"required,oneof=User Nutritionist"` // Admins are made in the database, never through the API
+	Email    string `json:"email" binding:"omitempty,email"`
 }
 
+// Usernames are at most 50 characters, like U_Username, which also keeps
+// throttle keys within their column.
 type LoginInput struct {
-	Username string `json:"username" binding:"required"`
+	Username string `json:"username" binding:"required,max=50"`
 	Password string `json:"password" binding:"required"`
 }
 
@@ -30,6 +40,10 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if weakPassword(c, input.Password, input.Username) {
+		return
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
@@ -41,6 +55,7 @@ func Register(c *gin.Context) {
 		Username: input.Username,
 		Password: string(hashedPassword),
 		Role:     input.Role,
+		Email:    input.Email,
 	}
 
 	if err := config.DB.Create(&user).Error; err != nil {
@@ -48,44 +63,242 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	c.Set("user_id", user.UID)
+	c.Set("role", user.Role)
+	recordAudit(c, "register", "user", user.UID, user.UID, nil, user)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Registration successful!",
 		"data":    user,
 	})
 }
 
+// Same message for unknown usernames and wrong passwords, so logins cannot be
+// used to find out which accounts exist.
+const invalidCredentials = "Invalid username or password"
+
+// dummyHash is compared against when the username does not exist, so that case
+// takes as long as a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// throttleKey is one failure counter an attempt is checked against: the account's
+// (whose lockouts are audited against that user) or the client IP's.
+type throttleKey struct {
+	key     string
+	limit   int
+	account bool
+}
+
+// loginKeys limits the typed username to LOGIN_MAX_FAILURES failures and the IP
+// to LOGIN_MAX_IP_FAILURES.
+func loginKeys(c *gin.Context, username string) []throttleKey {
+	return []throttleKey{
+		{key: "user:" + strings.ToLower(username), limit: config.EnvInt("LOGIN_MAX_FAILURES", 5), account: true},
+		{key: "ip:" + c.ClientIP(), limit: config.EnvInt("LOGIN_MAX_IP_FAILURES", 20)},
+	}
+}
+
+// attempt is a failure counted in advance by reserveAttempt; it is settled with
+// failed or succeeded once the password or code has been checked.
+type attempt struct {
+	c      *gin.Context
+	keys   []throttleKey
+	locked []models.LoginThrottle // counters this attempt locked out
+}
+
+var errThrottled = errors.New("throttled")
+
+// reserveAttempt counts a failure against every key before anything is checked,
+// so concurrent guesses are throttled exactly like consecutive ones. It answers
+// 429 instead when a key is throttled (see reserveKeys).
+func reserveAttempt(c *gin.Context, keys []throttleKey) (*attempt, bool) {
+	reserved, retryAt, err := reserveKeys(c, keys)
+	if errors.Is(err, errThrottled) {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(retryAt).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("login throttle: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check login attempts"})
+		return nil, false
+	}
+	return reserved, true
+}
+
+// reserveKeys adds a failure to every key in one locked transaction, or none and
+// errThrottled with the time to retry at when a key is locked out or has to wait
+// out the delay that grows with every failure after LOGIN_DELAY_AFTER (default
+// 3). A key reaching its limit is locked for LOGIN_LOCKOUT_MINUTES.
+func reserveKeys(c *gin.Context, keys []throttleKey) (*attempt, time.Time, error) {
+	window := time.Duration(config.EnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute
+	lockout := time.Duration(config.EnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+	delayAfter := config.EnvInt("LOGIN_DELAY_AFTER", 3)
+	now := time.Now()
+
+	a := &attempt{c: c, keys: keys}
+	var retryAt time.Time
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		throttles := make([]models.LoginThrottle, len(keys))
+		for i, k := range keys {
+			t := &throttles[i]
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{LTKey: k.key, LTLastFailureAt: now}).Error; err != nil {
+				return err
+			}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("LT_Key = ?", k.key).First(t).Error; err != nil {
+				return err
+			}
+
+			// Start over once the window has passed or a lockout has run out.
+			if t.LTLastFailureAt.Before(now.Add(-window)) || (t.LTLockedUntil != nil && !t.LTLockedUntil.After(now)) {
+				t.LTFailures = 0
+				t.LTLockedUntil = nil
+			}
+
+			if t.LTLockedUntil != nil && t.LTLockedUntil.After(retryAt) {
+				retryAt = *t.LTLockedUntil
+			}
+			if t.LTFailures >= delayAfter {
+				delay := time.Duration(1<<min(t.LTFailures-delayAfter, 6)) * time.Second
+				if next := t.LTLastFailureAt.Add(delay); next.After(retryAt) {
+					retryAt = next
+				}
+			}
+		}
+		if retryAt.After(now) {
+			return errThrottled
+		}
+
+		for i, k := range keys {
+			t := &throttles[i]
+			t.LTFailures++
+			t.LTLastFailureAt = now
+			if t.LTFailures >= k.limit {
+				until := now.Add(lockout)
+				t.LTLockedUntil = &until
+				a.locked = append(a.locked, *t)
+			}
+			if err := tx.Save(t).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, retryAt, err
+	}
+	return a, retryAt, nil
+}
+
+// failed keeps the reserved failure and writes every lockout it caused to the
+// audit log, against userID for the account's counter.
+func (a *attempt) failed(userID string) {
+	for _, t := range a.locked {
+		subject := ""
+		for _, k := range a.keys {
+			if k.key == t.LTKey && k.account {
+				subject = userID
+			}
+		}
+		recordAudit(a.c, "lockout", "login", t.LTKey, subject, nil, gin.H{
+			"ip":           a.c.ClientIP(),
+			"failures":     t.LTFailures,
+			"locked_until": t.LTLockedUntil,
+		})
+	}
+}
+
+// succeeded clears the account's failures and takes the reserved failure back
+// from the IP, without forgetting its earlier ones, so one valid account cannot be
+// used to keep guessing at others.
+func (a *attempt) succeeded() {
+	for _, k := range a.keys {
+		if k.account {
+			config.DB.Where("LT_Key = ?", k.key).Delete(&models.LoginThrottle{})
+			continue
+		}
+
+		updates := map[string]interface{}{"LT_Failures": gorm.Expr("LT_Failures - 1")}
+		for _, t := range a.locked {
+			if t.LTKey == k.key {
+				updates["LT_LockedUntil"] = nil
+			}
+		}
+		config.DB.Model(&models.LoginThrottle{}).Where("LT_Key = ? AND LT_Failures > 0", k.key).Updates(updates)
+	}
+}
+
+// checkCredentials looks up the user and checks the password, with throttling.
+// On failure it has already answered the request.
+func checkCredentials(c *gin.Context, input LoginInput) (models.User, bool) {
+	var user models.User
+
+	reserved, ok := reserveAttempt(c, loginKeys(c, input.Username))
+	if !ok {
+		return user, false
+	}
+
+	found := config.DB.Where("U_Username = ?", input.Username).First(&user).Error == nil
+	hash := dummyHash
+	if found {
+		hash = []byte(user.Password)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(input.Password)); err != nil || !found {
+		reserved.failed(user.UID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": invalidCredentials})
+		return user, false
+	}
+
+	reserved.succeeded()
+	return user, true
+}
+
 func Login(c *gin.Context) {
 	var input LoginInput
-	var user models.User
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Find user by username
-	if err := config.DB.Where("U_Username = ?", input.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+	user, ok := checkCredentials(c, input)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":       "Account is scheduled for deletion, restore it to log in",
+			"purge_after": user.PurgeAfter,
+		})
 		return
 	}
 
-	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect password"})
+	// With 2FA the password only earns a challenge token; the session token comes
+	// from /login/2fa, or from /login/2fa/enable for users who must enroll first.
+	purpose := ""
+	if user.TOTPEnabled {
+		purpose = challengeTwoFactor
+	} else if twoFactorEnforced(user) {
+		purpose = challengeSetup
+	}
+	if purpose == "" {
+		issueLogin(c, user, nil)
 		return
 	}
 
-	// Generate JWT Token
-	token, err := utils.GenerateToken(user.UID, user.Role)
+	challenge, err := utils.GenerateChallengeToken(user.UID, purpose, user.SessionVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
-		"role":    user.Role,
-		"user_id": user.UID,
+		"message":                   "Password accepted, second step required",
+		"two_factor_required":       purpose == challengeTwoFactor,
+		"two_factor_setup_required": purpose == challengeSetup,
+		"challenge_token":           challenge,
 	})
 }
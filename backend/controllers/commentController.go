@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"errors"
+	"fp-pbkk/config"
+	"fp-pbkk/events"
+	"fp-pbkk/mailer"
+	"fp-pbkk/models"
+	"fp-pbkk/notify"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CommentInput struct {
+	Content  string  `json:"content" binding:"required"`
+	ParentID *uint   `json:"parent_id"` // set to reply to another comment of the same day
+	MealID   *string `json:"meal_id"`   // set to comment on one meal rather than the whole day
+}
+
+// commentAccess checks that the caller takes part in the day's conversation: the
+// client who owns it, or a nutritionist the client is assigned to. It answers the
+// request itself and returns false otherwise.
+func commentAccess(c *gin.Context, diID string) (models.DailyIntake, bool) {
+	userID := c.GetString("user_id")
+	role, _ := c.Get("role")
+
+	var intake models.DailyIntake
+	err := config.DB.Select("DI_ID", "DI_Date", "CustomerUsers_U_ID").Where("DI_ID = ?", diID).First(&intake).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "intake not found"})
+		return intake, false
+	}
+
+	switch {
+	case role == "Nutritionist" && isAssignedNutritionist(userID, intake.CustomerUserID):
+	case role != "Nutritionist" && intake.CustomerUserID == userID:
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "not a participant of this day"})
+		return intake, false
+	}
+	return intake, true
+}
+
+// markCommentsRead moves the user's read marker for the day to now.
+func markCommentsRead(db *gorm.DB, diID string, userID string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "Daily_Intakes_DI_ID"}, {Name: "U_ID"}},
+		DoUpdates: clause.AssignmentColumns([]string{"CR_ReadAt"}),
+	}).Create(&models.CommentRead{
+		DailyIntakeID: diID,
+		UserID:        userID,
+		CRReadAt:      time.Now(),
+	}).Error
+}
+
+// unreadCounts returns, per day, how many comments by others the user has not read yet.
+func unreadCounts(userID string, diIDs []string) map[string]int {
+	counts := map[string]int{}
+	if len(diIDs) == 0 {
+		return counts
+	}
+
+	var rows []struct {
+		DIID   string `gorm:"column:di_id"`
+		Unread int    `gorm:"column:unread"`
+	}
+	config.DB.Model(&models.Comment{}).
+		Select("comments.Daily_Intakes_DI_ID AS di_id, COUNT(*) AS unread").
+		Joins("LEFT JOIN comment_reads ON comment_reads.Daily_Intakes_DI_ID = comments.Daily_Intakes_DI_ID AND comment_reads.U_ID = ?", userID).
+		Where("comments.Daily_Intakes_DI_ID IN ? AND comments.C_AuthorID <> ?", diIDs, userID).
+		Where("comment_reads.CR_ReadAt IS NULL OR comments.C_CreatedAt > comment_reads.CR_ReadAt").
+		Group("comments.Daily_Intakes_DI_ID").
+		Scan(&rows)
+
+	for _, r := range rows {
+		counts[r.DIID] = r.Unread
+	}
+	return counts
+}
+
+// threadComments nests replies under their parents. Replies whose parent was
+// deleted are kept at the top level so they do not disappear.
+func threadComments(flat []models.Comment) []models.Comment {
+	children := map[uint][]models.Comment{}
+	present := map[uint]bool{}
+	for _, cm := range flat {
+		present[cm.CID] = true
+	}
+
+	var roots []models.Comment
+	for _, cm := range flat {
+		if cm.ParentID != nil && present[*cm.ParentID] {
+			children[*cm.ParentID] = append(children[*cm.ParentID], cm)
+		} else {
+			roots = append(roots, cm)
+		}
+	}
+
+	var attach func(list []models.Comment) []models.Comment
+	attach = func(list []models.Comment) []models.Comment {
+		for i := range list {
+			list[i].Replies = attach(children[list[i].CID])
+		}
+		return list
+	}
+	return attach(roots)
+}
+
+// createComment posts a comment or reply on a day for whoever is calling. The
+// caller's own read marker moves along, since they have obviously seen the thread.
+func createComment(c *gin.Context, diID string, input CommentInput) (models.Comment, bool) {
+	intake, ok := commentAccess(c, diID)
+	if !ok {
+		return models.Comment{}, false
+	}
+
+	if input.MealID != nil {
+		var count int64
+		config.DB.Model(&models.Meal{}).Where("M_ID = ? AND Daily_Intakes_DI_ID = ?", *input.MealID, diID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "meal does not belong to this day"})
+			return models.Comment{}, false
+		}
+	}
+
+	if input.ParentID != nil {
+		var parent models.Comment
+		if err := config.DB.Where("c_id = ? AND Daily_Intakes_DI_ID = ?", *input.ParentID, diID).First(&parent).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent comment not found on this day"})
+			return models.Comment{}, false
+		}
+		// A reply stays in the thread it answers, on the day or on the same meal.
+		if input.MealID != nil && (parent.MealID == nil || *parent.MealID != *input.MealID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reply must be about the same meal as its parent"})
+			return models.Comment{}, false
+		}
+		input.MealID = parent.MealID
+	}
+
+	userID := c.GetString("user_id")
+	role := c.GetString("role")
+
+	comment := models.Comment{
+		CContent:      input.Content,
+		DailyIntakeID: diID,
+		ParentID:      input.ParentID,
+		MealID:        input.MealID,
+		AuthorID:      userID,
+		AuthorRole:    role,
+	}
+	if role == "Nutritionist" {
+		comment.NutritionistID = userID
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		return markCommentsRead(tx, diID, userID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return models.Comment{}, false
+	}
+
+	owner := intake.CustomerUserID
+	recordAudit(c, "create", "comment", strconv.FormatUint(uint64(comment.CID), 10), owner, nil, comment)
+
+	recipients := dayParticipants(owner, userID)
+	events.Publish(events.CommentCreated, comment, recipients...)
+
+	var author models.User
+	config.DB.Select("U_Username").Where("U_ID = ?", userID).First(&author)
+	notifications := make([]models.Notification, len(recipients))
+	for i, id := range recipients {
+		notifications[i] = models.Notification{
+			UserID: id,
+			NType:  notify.CommentAdded,
+			NTitle: author.Username + " commented on " + intake.DIDate.Format("2 Jan 2006"),
+			NBody:  comment.CContent,
+			NLink:  dayLink(id, owner),
+		}
+	}
+	notify.Send(notifications...)
+
+	// Clients also get nutritionist feedback by email when they have an address.
+	if role == "Nutritionist" {
+		var client models.User
+		config.DB.Select("U_Username", "U_Email").Where("U_ID = ?", owner).First(&client)
+		if _, err := mailer.Enqueue("comment", owner, client.Email, mailer.CommentData{
+			Name:    client.Username,
+			Author:  author.Username,
+			Date:    intake.DIDate.Format("2 Jan 2006"),
+			Content: comment.CContent,
+			Link:    mailer.Link(dayLink(owner, owner)),
+		}, nil); err != nil {
+			log.Printf("comment %d: queue email: %v", comment.CID, err)
+		}
+	}
+
+	return comment, true
+}
+
+// POST /intake/:di_id/comments
+func AddDayComment(c *gin.Context) {
+	var input CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
+		return
+	}
+
+	comment, ok := createComment(c, c.Param("di_id"), input)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// GET /intake/:di_id/comments?meal_id=
+// Returns the day's conversation as a tree, oldest first, with the caller's unread
+// count. With meal_id only the comments on that meal are returned.
+func GetDayComments(c *gin.Context) {
+	diID := c.Param("di_id")
+	if _, ok := commentAccess(c, diID); !ok {
+		return
+	}
+
+	query := config.DB.
+		Preload("Author").
+		Where("Daily_Intakes_DI_ID = ?", diID)
+	if mealID := c.Query("meal_id"); mealID != "" {
+		query = query.Where("Meals_M_ID = ?", mealID)
+	}
+
+	var comments []models.Comment
+	if err := query.Order("C_CreatedAt ASC, c_id ASC").Find(&comments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   threadComments(comments),
+		"unread": unreadCounts(c.GetString("user_id"), []string{diID})[diID],
+	})
+}
+
+// POST /intake/:di_id/comments/read
+func MarkCommentsRead(c *gin.Context) {
+	diID := c.Param("di_id")
+	if _, ok := commentAccess(c, diID); !ok {
+		return
+	}
+
+	if err := markCommentsRead(config.DB, diID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "comments marked as read"})
+}
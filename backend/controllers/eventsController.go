@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/events"
+	"fp-pbkk/middleware"
+	"fp-pbkk/models"
+	"fp-pbkk/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dayParticipants returns the client and every nutritionist assigned to them,
+// leaving out except (usually whoever caused the event).
+func dayParticipants(clientID string, except string) []string {
+	var ids []string
+	config.DB.Model(&models.ClientAssignment{}).Scopes(models.AcceptedAssignments).
+		Where("CustomerUsers_U_ID = ?", clientID).
+		Pluck("NutritionistUsers_U_ID", &ids)
+	ids = append(ids, clientID)
+
+	out := ids[:0]
+	for _, id := range ids {
+		if id != except {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// POST /stream-tickets {"purpose": "events" | "messages"}
+// Issues a ticket for opening /events or /messages/ws from a browser, which cannot
+// send the Authorization header there. It works once, within 30 seconds.
+func CreateStreamTicket(c *gin.Context) {
+	var input struct {
+		Purpose string `json:"purpose" binding:"required,oneof=events messages"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Select("U_ID", "U_Role", "U_SessionVersion").Where("U_ID = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ticket, err := utils.GenerateStreamTicket(user.UID, user.Role, input.Purpose, user.SessionVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate ticket"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": 30})
+}
+
+// GET /events
+// Server-Sent Events stream of everything published to the caller. Browsers'
+// EventSource cannot set headers, so they authenticate with ?ticket= instead. The
+// session is checked again on every heartbeat, and the stream ends once it has
+// been signed out.
+func StreamEvents(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	stream, unsubscribe := events.Subscribe(userID)
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(time.Duration(config.EnvInt("EVENTS_HEARTBEAT_SECONDS", 25)) * time.Second)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString(": connected\n\n")
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !middleware.SessionStillActive(c) {
+				return
+			}
+			// A comment line keeps proxies from closing an idle connection.
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case ev := <-stream:
+			c.SSEvent(ev.Type, ev)
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/utils"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const exportBatchSize = 500
+
+// exportTable writes one file of the export archive, either as CSV with a header
+// row or as a JSON array, one record at a time.
+type exportTable struct {
+	w      io.Writer
+	csv    *csv.Writer
+	format string
+	rows   int
+}
+
+func newExportTable(zw *zip.Writer, name string, format string, header []string) (*exportTable, error) {
+	w, err := zw.Create(name + "." + format)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &exportTable{w: w, format: format}
+	if format == "csv" {
+		t.csv = csv.NewWriter(w)
+		return t, t.csv.Write(header)
+	}
+	_, err = io.WriteString(w, "[\n")
+	return t, err
+}
+
+func (t *exportTable) add(record interface{}, cells []string) error {
+	t.rows++
+	if t.csv != nil {
+		return t.csv.Write(cells)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if t.rows > 1 {
+		io.WriteString(t.w, ",\n")
+	}
+	_, err = t.w.Write(data)
+	return err
+}
+
+func (t *exportTable) close() error {
+	if t.csv != nil {
+		t.csv.Flush()
+		return t.csv.Error()
+	}
+	_, err := io.WriteString(t.w, "\n]\n")
+	return err
+}
+
+func ftoa(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// GET /export?format=csv|json
+func ExportData(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("U_ID = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="calorisync_%s_%s.zip"`,
+		utils.SafeFilename(user.Username), time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	if err := writeExport(zw, user, format, c.Writer); err != nil {
+		// Headers are already sent; the truncated archive tells the client it failed.
+		c.Error(err)
+		return
+	}
+	zw.Close()
+}
+
+// exportAuthor is all an export shows of whoever wrote a comment; their profile
+// belongs to them, not to the client exporting.
+type exportAuthor struct {
+	ID       string `json:"u_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type exportComment struct {
+	CID       uint         `json:"c_id"`
+	DIID      string       `json:"di_id"`
+	MealID    *string      `json:"meal_id"`
+	ParentID  *uint        `json:"parent_id"`
+	Content   string       `json:"content"`
+	CreatedAt time.Time    `json:"created_at"`
+	Author    exportAuthor `json:"author"`
+}
+
+func writeExport(zw *zip.Writer, user models.User, format string, flusher http.Flusher) error {
+	profile, err := newExportTable(zw, "profile", format,
+		[]string{"u_id", "username", "role", "height", "weight", "age", "gender", "bmi", "bmr", "time_zone"})
+	if err != nil {
+		return err
+	}
+	profile.add(user, []string{user.UID, user.Username, user.Role, ftoa(user.Height), ftoa(user.Weight),
+		strconv.Itoa(user.Age), user.Gender, ftoa(user.BMI), ftoa(user.BMR), user.TimeZone})
+	if err := profile.close(); err != nil {
+		return err
+	}
+
+	intakes, err := newExportTable(zw, "daily_intakes", format,
+		[]string{"di_id", "date", "total_calories", "is_locked"})
+	if err != nil {
+		return err
+	}
+	var intakeBatch []models.DailyIntake
+	if err := config.DB.Where("CustomerUsers_U_ID = ?", user.UID).
+		FindInBatches(&intakeBatch, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, di := range intakeBatch {
+				if err := intakes.add(di, []string{di.DIID, di.DIDate.Format("2006-01-02"),
+					strconv.Itoa(di.DITotalCalories), strconv.FormatBool(di.DIIsLocked)}); err != nil {
+					return err
+				}
+			}
+			flusher.Flush()
+			return nil
+		}).Error; err != nil {
+		return err
+	}
+	if err := intakes.close(); err != nil {
+		return err
+	}
+
+	meals, err := newExportTable(zw, "meals", format,
+		[]string{"m_id", "di_id", "time", "food_name", "calories", "protein", "carbs", "fat"})
+	if err != nil {
+		return err
+	}
+	var mealBatch []models.Meal
+	if err := config.DB.Where("U_ID = ?", user.UID).
+		FindInBatches(&mealBatch, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, m := range mealBatch {
+				if err := meals.add(m, []string{m.MID, m.DailyIntakeID, m.Time, m.MFoodName,
+					strconv.Itoa(m.MCalories), ftoa(m.MProtein), ftoa(m.MCarbs), ftoa(m.MFat)}); err != nil {
+					return err
+				}
+			}
+			flusher.Flush()
+			return nil
+		}).Error; err != nil {
+		return err
+	}
+	if err := meals.close(); err != nil {
+		return err
+	}
+
+	comments, err := newExportTable(zw, "comments", format,
+		[]string{"c_id", "di_id", "nutritionist", "content", "meal_id", "parent_id", "author", "author_role", "author_id"})
+	if err != nil {
+		return err
+	}
+	var commentBatch []models.Comment
+	if err := config.DB.
+		Preload("Nutritionist").
+		Preload("Author").
+		Joins("JOIN daily_intakes ON daily_intakes.DI_ID = comments.Daily_Intakes_DI_ID").
+		Where("daily_intakes.CustomerUsers_U_ID = ?", user.UID).
+		FindInBatches(&commentBatch, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, cm := range commentBatch {
+				mealID, parentID := "", ""
+				if cm.MealID != nil {
+					mealID = *cm.MealID
+				}
+				if cm.ParentID != nil {
+					parentID = strconv.FormatUint(uint64(*cm.ParentID), 10)
+				}
+				record := exportComment{
+					CID:       cm.CID,
+					DIID:      cm.DailyIntakeID,
+					MealID:    cm.MealID,
+					ParentID:  cm.ParentID,
+					Content:   cm.CContent,
+					CreatedAt: cm.CreatedAt,
+					Author:    exportAuthor{ID: cm.AuthorID, Username: cm.Author.Username, Role: cm.AuthorRole},
+				}
+				if err := comments.add(record, []string{strconv.FormatUint(uint64(cm.CID), 10), cm.DailyIntakeID,
+					cm.Nutritionist.Username, cm.CContent, mealID, parentID, cm.Author.Username, cm.AuthorRole, cm.AuthorID}); err != nil {
+					return err
+				}
+			}
+			flusher.Flush()
+			return nil
+		}).Error; err != nil {
+		return err
+	}
+	return comments.close()
+}
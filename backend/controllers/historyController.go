@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxHistoryDays caps how wide a single range request can be.
+const maxHistoryDays = 366
+
+type IntakeDaySummary struct {
+	DIID          string    `gorm:"column:di_id" json:"di_id"`
+	Date          time.Time `gorm:"column:di_date" json:"date"`
+	TotalCalories int       `gorm:"column:total_calories" json:"total_calories"`
+	IsLocked      bool      `gorm:"column:is_locked" json:"is_locked"`
+	MealCount     int       `gorm:"column:meal_count" json:"meal_count"`
+	Protein       float64   `gorm:"column:protein" json:"protein"`
+	Carbs         float64   `gorm:"column:carbs" json:"carbs"`
+	Fat           float64   `gorm:"column:fat" json:"fat"`
+	Status        string    `gorm:"-" json:"status"`
+}
+
+type IntakeRangeAggregates struct {
+	DaysLogged      int     `gorm:"column:days_logged" json:"days_logged"`
+	AverageCalories float64 `gorm:"column:avg_calories" json:"average_calories"`
+	DaysOverTarget  int     `gorm:"column:days_over" json:"days_over_target"`
+	DaysUnderTarget int     `gorm:"column:days_under" json:"days_under_target"`
+	AverageProtein  float64 `gorm:"column:avg_protein" json:"average_protein"`
+	AverageCarbs    float64 `gorm:"column:avg_carbs" json:"average_carbs"`
+	AverageFat      float64 `gorm:"column:avg_fat" json:"average_fat"`
+	Target          float64 `gorm:"-" json:"target"`
+}
+
+// parseDateRange reads ?from=&to= as an inclusive YYYY-MM-DD range.
+func parseDateRange(c *gin.Context) (time.Time, time.Time, bool) {
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := time.Parse("2006-01-02", c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) >= maxHistoryDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "range is limited to 366 days"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// intakeHistory sums every day of a user's range in SQL, one row per DailyIntake,
+// plus the aggregates over the days that have at least one meal.
+func intakeHistory(userID string, from time.Time, to time.Time, bmr float64) ([]IntakeDaySummary, IntakeRangeAggregates, error) {
+	perDay := config.DB.Model(&models.DailyIntake{}).
+		Select(`daily_intakes.DI_ID AS di_id,
+			daily_intakes.DI_Date AS di_date,
+			daily_intakes.DI_TotalCalories AS total_calories,
+			daily_intakes.DI_isLocked AS is_locked,
+			COUNT(meals.M_ID) AS meal_count,
+			COALESCE(SUM(meals.M_Protein), 0) AS protein,
+			COALESCE(SUM(meals.M_Carbs), 0) AS carbs,
+			COALESCE(SUM(meals.M_Fat), 0) AS fat`).
+		Joins("LEFT JOIN meals ON meals.Daily_Intakes_DI_ID = daily_intakes.DI_ID AND meals.M_DeletedAt IS NULL").
+		Where("daily_intakes.CustomerUsers_U_ID = ? AND daily_intakes.DI_Date BETWEEN ? AND ?",
+			userID, from.Format("2006-01-02"), to.Format("2006-01-02")).
+		Group("daily_intakes.DI_ID, daily_intakes.DI_Date, daily_intakes.DI_TotalCalories, daily_intakes.DI_isLocked")
+
+	var days []IntakeDaySummary
+	if err := perDay.Session(&gorm.Session{}).Order("di_date").Scan(&days).Error; err != nil {
+		return nil, IntakeRangeAggregates{}, err
+	}
+	for i := range days {
+		days[i].Status = utils.IntakeStatus(days[i].TotalCalories, bmr)
+	}
+
+	var agg IntakeRangeAggregates
+	err := config.DB.Table("(?) AS d", perDay).
+		Select(`COUNT(*) AS days_logged,
+			COALESCE(AVG(d.total_calories), 0) AS avg_calories,
+			COALESCE(SUM(d.total_calories > ?), 0) AS days_over,
+			COALESCE(SUM(d.total_calories < ?), 0) AS days_under,
+			COALESCE(AVG(d.protein), 0) AS avg_protein,
+			COALESCE(AVG(d.carbs), 0) AS avg_carbs,
+			COALESCE(AVG(d.fat), 0) AS avg_fat`, bmr, bmr-200).
+		Where("d.meal_count > 0").
+		Scan(&agg).Error
+	agg.Target = bmr
+
+	return days, agg, err
+}
+
+// GET INTAKE HISTORY
+func GetIntakeHistory(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("U_ID = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	days, agg, err := intakeHistory(userID, from, to, user.BMR)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":       from.Format("2006-01-02"),
+		"to":         to.Format("2006-01-02"),
+		"days":       days,
+		"aggregates": agg,
+	})
+}
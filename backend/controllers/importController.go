@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxImportBytes = 10 << 20
+
+// errDayLockedMeanwhile aborts an import when a day was locked after the rows
+// were checked.
+var errDayLockedMeanwhile = errors.New("locked while importing")
+
+// importColumns is the CSV layout accepted by ImportMeals. The header row is
+// required; columns may come in any order and protein, carbs and fat may be left out.
+//
+//	date      YYYY-MM-DD, the day the meal belongs to
+//	time      HH:MM, 24-hour clock (optional, may be empty)
+//	food      food name, up to 100 characters
+//	calories  whole kcal, 0 or more
+//	protein   grams (optional)
+//	carbs     grams (optional)
+//	fat       grams (optional)
+var importColumns = []string{"date", "time", "food", "calories", "protein", "carbs", "fat"}
+
+type ImportRowError struct {
+	Row   int    `json:"row"` // line number in the file, header is row 1
+	Error string `json:"error"`
+}
+
+type importRow struct {
+	line int
+	meal models.Meal
+}
+
+func parseImportRow(record []string, col map[string]int) (string, models.Meal, error) {
+	get := func(name string) string {
+		if i, ok := col[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	macro := func(name string) (float64, error) {
+		v := get(name)
+		if v == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return 0, fmt.Errorf("invalid %s %q", name, v)
+		}
+		return f, nil
+	}
+
+	var meal models.Meal
+
+	date := get("date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", meal, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+
+	meal.Time = get("time")
+	if meal.Time != "" {
+		if _, err := time.Parse("15:04", meal.Time); err != nil {
+			return "", meal, fmt.Errorf("invalid time %q, expected HH:MM", meal.Time)
+		}
+	}
+
+	meal.MFoodName = get("food")
+	if meal.MFoodName == "" || len(meal.MFoodName) > 100 {
+		return "", meal, errors.New("food is required and limited to 100 characters")
+	}
+
+	calories, err := strconv.Atoi(get("calories"))
+	if err != nil || calories < 0 {
+		return "", meal, fmt.Errorf("invalid calories %q", get("calories"))
+	}
+	meal.MCalories = calories
+
+	if meal.MProtein, err = macro("protein"); err != nil {
+		return "", meal, err
+	}
+	if meal.MCarbs, err = macro("carbs"); err != nil {
+		return "", meal, err
+	}
+	if meal.MFat, err = macro("fat"); err != nil {
+		return "", meal, err
+	}
+
+	return date, meal, nil
+}
+
+// recomputeTotal sets a day's total to the sum of its meals and bumps its version.
+func recomputeTotal(tx *gorm.DB, diID string) error {
+	return tx.Model(&models.DailyIntake{}).
+		Where("DI_ID = ?", diID).
+		Updates(map[string]interface{}{
+			"DI_TotalCalories": tx.Model(&models.Meal{}).
+				Select("COALESCE(SUM(M_Calories), 0)").
+				Where("Daily_Intakes_DI_ID = ?", diID),
+			"DI_Version": gorm.Expr("DI_Version + 1"),
+		}).Error
+}
+
+// IMPORT MEALS
+// POST /import?dry_run=true with the CSV as multipart field "file" (see importColumns).
+// Rows for days that are locked are reported as errors and left untouched.
+func ImportMeals(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file required in field \"file\""})
+		return
+	}
+	if file.Size > maxImportBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is limited to 10 MB"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read file"})
+		return
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing header row"})
+		return
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range importColumns[:4] {
+		if _, ok := col[required]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "missing column " + required,
+				"columns": importColumns,
+			})
+			return
+		}
+	}
+
+	var rowErrors []ImportRowError
+	byDate := map[string][]importRow{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: line, Error: err.Error()})
+			continue
+		}
+
+		date, meal, err := parseImportRow(record, col)
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: line, Error: err.Error()})
+			continue
+		}
+		byDate[date] = append(byDate[date], importRow{line: line, meal: meal})
+	}
+
+	dates := make([]string, 0, len(byDate))
+	for d := range byDate {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+
+	// Look up existing days once so locked days can be reported in the preview too.
+	var existing []models.DailyIntake
+	config.DB.Where("CustomerUsers_U_ID = ? AND DI_Date IN ?", userID, dates).Find(&existing)
+	existingByDate := map[string]models.DailyIntake{}
+	for _, di := range existing {
+		existingByDate[di.DIDate.Format("2006-01-02")] = di
+	}
+
+	valid := 0
+	daysCreated := 0
+	var importable []string
+	for _, d := range dates {
+		di, found := existingByDate[d]
+		if found && !intakeWritable(di) {
+			for _, r := range byDate[d] {
+				rowErrors = append(rowErrors, ImportRowError{Row: r.line, Error: "day " + d + " is locked"})
+			}
+			continue
+		}
+		if !found {
+			daysCreated++
+		}
+		valid += len(byDate[d])
+		importable = append(importable, d)
+	}
+	sort.Slice(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+
+	result := gin.H{
+		"dry_run":      dryRun,
+		"rows_total":   line - 1,
+		"rows_valid":   valid,
+		"days_created": daysCreated,
+		"errors":       rowErrors,
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, d := range importable {
+			parsed, _ := time.Parse("2006-01-02", d)
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.DailyIntake{
+				DIID:           uuid.New().String(),
+				DIDate:         parsed,
+				CustomerUserID: userID,
+			}).Error; err != nil {
+				return err
+			}
+
+			// The day may have been locked since it was checked above. Holding the
+			// row lock keeps LockIntake and the auto-lock job out until we commit.
+			var di models.DailyIntake
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("CustomerUsers_U_ID = ? AND DI_Date = ?", userID, d).First(&di).Error; err != nil {
+				return err
+			}
+			if !intakeWritable(di) {
+				return fmt.Errorf("day %s %w", d, errDayLockedMeanwhile)
+			}
+			claimed := tx.Model(&models.DailyIntake{}).
+				Where("DI_ID = ? AND DI_isLocked = ? AND DI_Version = ?", di.DIID, di.DIIsLocked, di.DIVersion).
+				Update("DI_Version", gorm.Expr("DI_Version + 1"))
+			if claimed.Error != nil {
+				return claimed.Error
+			}
+			if claimed.RowsAffected == 0 {
+				return fmt.Errorf("day %s %w", d, errDayLockedMeanwhile)
+			}
+
+			meals := make([]models.Meal, 0, len(byDate[d]))
+			for _, r := range byDate[d] {
+				m := r.meal
+				m.MID = uuid.New().String()
+				m.DailyIntakeID = di.DIID
+				m.UID = userID
+				meals = append(meals, m)
+			}
+			if err := tx.CreateInBatches(&meals, 200).Error; err != nil {
+				return err
+			}
+
+			if err := recomputeTotal(tx, di.DIID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errDayLockedMeanwhile) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error() + ", nothing was saved"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "import failed, nothing was saved: " + err.Error()})
+		return
+	}
+
+	result["rows_imported"] = valid
+	c.JSON(http.StatusOK, result)
+}
@@ -3,59 +3,145 @@ package controllers
 import (
 	"errors"
 	"fp-pbkk/config"
+	"fp-pbkk/events"
 	"fp-pbkk/models"
+	"fp-pbkk/utils"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MealInput struct {
 	FoodName string `json:"food_name" binding:"required"`
 	Calories int    `json:"calories" binding:"required"`
 	Time     string `json:"time"`
+	// Macros in grams, optional.
+	Protein float64 `json:"protein"`
+	Carbs   float64 `json:"carbs"`
+	Fat     float64 `json:"fat"`
 }
 
-// GET TODAY INTAKE
-func GetOrCreateTodayIntake(c *gin.Context) {
+// userLocation loads the time zone the user's days are bucketed in.
+func userLocation(userID string) *time.Location {
+	var user models.User
+	config.DB.Select("U_TimeZone").Where("U_ID = ?", userID).First(&user)
+	return utils.UserLocation(user.TimeZone)
+}
+
+// preloadIntake loads everything an intake response shows. Comments on a meal are
+// nested under that meal; the day's own list only has the ones about the whole day.
+func preloadIntake(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Meals").
+		Preload("Meals.Comments").
+		Preload("Meals.Comments.Nutritionist").
+		Preload("Meals.Comments.Author").
+		Preload("Comments", "Meals_M_ID IS NULL").
+		Preload("Comments.Nutritionist").
+		Preload("Comments.Author")
+}
+
+// decorateIntake fills the computed, non-stored parts of an intake response.
+func decorateIntake(intake *models.DailyIntake) {
+	attachPlan(intake)
+	flagEditsAfterComment(intake)
+}
+
+// errVersionConflict aborts a write whose If-Match no longer matches the row.
+var errVersionConflict = errors.New("version conflict")
+
+// ifMatch reads the version the client last saw from If-Match. Writes to meals and
+// intakes must send it so two devices cannot silently overwrite each other.
+func ifMatch(c *gin.Context) (int, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header required"})
+		return 0, false
+	}
+	version, ok := utils.ParseETag(header)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match header"})
+		return 0, false
+	}
+	return version, true
+}
+
+func versionConflict(c *gin.Context, current int) {
+	c.Header("ETag", utils.ETag(current))
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   "modified by another request, reload and try again",
+		"version": current,
+	})
+}
+
+// bumpIntake increments a day's version, optionally moving its total as well.
+func bumpIntake(tx *gorm.DB, diID string, calorieDiff int) error {
+	return tx.Model(&models.DailyIntake{}).
+		Where("DI_ID = ?", diID).
+		Updates(map[string]interface{}{
+			"DI_TotalCalories": gorm.Expr("GREATEST(DI_TotalCalories + ?, 0)", calorieDiff),
+			"DI_Version":       gorm.Expr("DI_Version + 1"),
+		}).Error
+}
+
+// CREATE OR GET INTAKE BY DATE
+// PUT /intake/:date with YYYY-MM-DD or "today". Safe to repeat: the unique
+// (user, date) index makes concurrent calls settle on the same row.
+// No If-Match here: the call never changes an existing day.
+func EnsureIntake(c *gin.Context) {
 	userID := c.GetString("user_id")
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
 		return
 	}
 
-	todayStr := time.Now().Format("2006-01-02")
+	dateStr := c.Param("date")
+	if dateStr == "today" {
+		dateStr = utils.LocalDate(time.Now(), userLocation(userID))
+	}
 
-	var intake models.DailyIntake
-	err := config.DB.
-		Preload("Meals").
-		Preload("Comments").
-		Preload("Comments.Nutritionist").
-		Where("CustomerUsers_U_ID = ? AND DATE(DI_Date) = ?", userID, todayStr).
-		First(&intake).Error
+	parsed, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format"})
+		return
+	}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		intake = models.DailyIntake{
-			DIID:            uuid.New().String(),
-			DIDate:          time.Now(),
-			DITotalCalories: 0,
-			DIIsLocked:      false,
-			CustomerUserID:  userID,
-		}
-		config.DB.Create(&intake)
-		config.DB.Preload("Meals").Preload("Comments").Preload("Comments.Nutritionist").First(&intake, "DI_ID = ?", intake.DIID)
-		c.JSON(http.StatusOK, intake)
+	intake := models.DailyIntake{
+		DIID:            uuid.New().String(),
+		DIDate:          parsed,
+		DITotalCalories: 0,
+		DIIsLocked:      false,
+		CustomerUserID:  userID,
+	}
+
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&intake)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
 
-	if err != nil {
+	status := http.StatusOK
+	if result.RowsAffected > 0 {
+		status = http.StatusCreated
+		recordAudit(c, "create", "daily_intake", intake.DIID, userID, nil, intake)
+	}
+
+	intake = models.DailyIntake{}
+	if err := preloadIntake(config.DB).
+		Where("CustomerUsers_U_ID = ? AND DI_Date = ?", userID, dateStr).
+		First(&intake).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, intake)
+	decorateIntake(&intake)
+	intake.UnreadComments = unreadCounts(userID, []string{intake.DIID})[intake.DIID]
+	c.Header("ETag", utils.ETag(intake.DIVersion))
+	c.JSON(status, intake)
 }
 
 // GET INTAKE BY DATE
@@ -68,7 +154,7 @@ func GetDailyIntake(c *gin.Context) {
 
 	dateStr := c.Query("date")
 	if dateStr == "" {
-		dateStr = time.Now().Format("2006-01-02")
+		dateStr = utils.LocalDate(time.Now(), userLocation(userID))
 	}
 
 	if _, err := time.Parse("2006-01-02", dateStr); err != nil {
@@ -77,25 +163,12 @@ func GetDailyIntake(c *gin.Context) {
 	}
 
 	var intake models.DailyIntake
-	err := config.DB.
-		Preload("Meals").
-		Preload("Comments").
-		Preload("Comments.Nutritionist").
-		Where("CustomerUsers_U_ID = ? AND DATE(DI_Date) = ?", userID, dateStr).
+	err := preloadIntake(config.DB).
+		Where("CustomerUsers_U_ID = ? AND DI_Date = ?", userID, dateStr).
 		First(&intake).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		parsed, _ := time.Parse("2006-01-02", dateStr)
-		newIntake := models.DailyIntake{
-			DIID:            uuid.New().String(),
-			DIDate:          parsed,
-			DITotalCalories: 0,
-			DIIsLocked:      false,
-			CustomerUserID:  userID,
-		}
-		config.DB.Create(&newIntake)
-		config.DB.Preload("Meals").Preload("Comments").Preload("Comments.Nutritionist").First(&newIntake)
-		c.JSON(http.StatusOK, newIntake)
+		c.JSON(http.StatusNotFound, gin.H{"error": "intake not found", "date": dateStr})
 		return
 	}
 
@@ -104,6 +177,9 @@ func GetDailyIntake(c *gin.Context) {
 		return
 	}
 
+	decorateIntake(&intake)
+	intake.UnreadComments = unreadCounts(userID, []string{intake.DIID})[intake.DIID]
+	c.Header("ETag", utils.ETag(intake.DIVersion))
 	c.JSON(http.StatusOK, intake)
 }
 
@@ -122,13 +198,13 @@ func AddMeal(c *gin.Context) {
 	}
 
 	var intake models.DailyIntake
-	err := config.DB.Where("DI_ID = ? AND CustomerUserID = ?", diID, userID).First(&intake).Error
+	err := config.DB.Where("DI_ID = ? AND CustomerUsers_U_ID = ?", diID, userID).First(&intake).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "intake not found"})
 		return
 	}
 
-	if intake.DIIsLocked {
+	if !intakeWritable(intake) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "intake locked"})
 		return
 	}
@@ -141,27 +217,39 @@ func AddMeal(c *gin.Context) {
 
 	mealTime := input.Time
 	if mealTime == "" {
-		mealTime = time.Now().Format("15:04")
+		mealTime = time.Now().In(userLocation(userID)).Format("15:04")
 	}
 
 	newMeal := models.Meal{
 		MID:           uuid.New().String(),
 		MFoodName:     input.FoodName,
 		MCalories:     input.Calories,
+		MProtein:      input.Protein,
+		MCarbs:        input.Carbs,
+		MFat:          input.Fat,
 		Time:          mealTime,
 		DailyIntakeID: diID,
 		UID:           userID,
 	}
 
-	config.DB.Create(&newMeal)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newMeal).Error; err != nil {
+			return err
+		}
+		return bumpIntake(tx, diID, newMeal.MCalories)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	config.DB.Model(&models.DailyIntake{}).
-		Where("DI_ID = ?", diID).
-		Update("DI_TotalCalories", gorm.Expr("DI_TotalCalories + ?", newMeal.MCalories))
+	recordAudit(c, "create", "meal", newMeal.MID, userID, nil, newMeal)
+	checkGoalReached(diID)
 
 	var updated models.DailyIntake
-	config.DB.Preload("Meals").Preload("Comments").First(&updated, "DI_ID = ?", diID)
+	preloadIntake(config.DB).First(&updated, "DI_ID = ?", diID)
 
+	c.Header("ETag", utils.ETag(updated.DIVersion))
 	c.JSON(http.StatusCreated, updated)
 }
 
@@ -175,6 +263,11 @@ func DeleteMeal(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
 	var meal models.Meal
 	err := config.DB.Where("M_ID = ? AND U_ID = ?", mealID, userID).First(&meal).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -185,21 +278,105 @@ func DeleteMeal(c *gin.Context) {
 	var intake models.DailyIntake
 	config.DB.First(&intake, "DI_ID = ?", meal.DailyIntakeID)
 
-	if intake.DIIsLocked {
+	if !intakeWritable(intake) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "intake locked"})
 		return
 	}
 
-	config.DB.Model(&models.DailyIntake{}).
-		Where("DI_ID = ?", intake.DIID).
-		Update("DI_TotalCalories", gorm.Expr("GREATEST(DI_TotalCalories - ?, 0)", meal.MCalories))
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("M_Version = ?", version).Delete(&meal)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		return bumpIntake(tx, intake.DIID, -meal.MCalories)
+	})
+	if errors.Is(err, errVersionConflict) {
+		versionConflict(c, meal.MVersion)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	config.DB.Delete(&meal)
+	recordAudit(c, "delete", "meal", meal.MID, userID, meal, nil)
 
-	config.DB.Preload("Meals").First(&intake)
+	preloadIntake(config.DB).First(&intake, "DI_ID = ?", intake.DIID)
+	c.Header("ETag", utils.ETag(intake.DIVersion))
 	c.JSON(http.StatusOK, gin.H{"message": "meal deleted", "intake": intake})
 }
 
+// RESTORE MEAL
+// Brings back a deleted meal while it is still inside the retention window.
+func RestoreMeal(c *gin.Context) {
+	userID := c.GetString("user_id")
+	mealID := c.Param("meal_id")
+
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	retention := time.Duration(config.EnvInt("SOFT_DELETE_RETENTION_DAYS", 30)) * 24 * time.Hour
+
+	var meal models.Meal
+	err := config.DB.Unscoped().
+		Where("M_ID = ? AND U_ID = ? AND M_DeletedAt > ?", mealID, userID, time.Now().Add(-retention)).
+		First(&meal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no restorable meal found"})
+		return
+	}
+
+	var intake models.DailyIntake
+	config.DB.First(&intake, "DI_ID = ?", meal.DailyIntakeID)
+
+	if !intakeWritable(intake) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "intake locked"})
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&meal).Update("M_DeletedAt", nil).Error; err != nil {
+			return err
+		}
+		return recomputeTotal(tx, intake.DIID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c, "restore", "meal", meal.MID, userID, nil, meal)
+	checkGoalReached(intake.DIID)
+
+	preloadIntake(config.DB).First(&intake, "DI_ID = ?", intake.DIID)
+	c.Header("ETag", utils.ETag(intake.DIVersion))
+	c.JSON(http.StatusOK, gin.H{"message": "meal restored", "intake": intake})
+}
+
+// GET DELETED MEALS OF A DAY
+func GetDeletedMeals(c *gin.Context) {
+	userID := c.GetString("user_id")
+	diID := c.Param("di_id")
+
+	retention := time.Duration(config.EnvInt("SOFT_DELETE_RETENTION_DAYS", 30)) * 24 * time.Hour
+
+	var meals []models.Meal
+	if err := config.DB.Unscoped().
+		Where("Daily_Intakes_DI_ID = ? AND U_ID = ? AND M_DeletedAt > ?", diID, userID, time.Now().Add(-retention)).
+		Order("M_DeletedAt DESC").
+		Find(&meals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": meals})
+}
+
 // EDIT MEAL
 func EditMeal(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -210,12 +387,29 @@ func EditMeal(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
 	var meal models.Meal
 	err := config.DB.Where("M_ID = ? AND U_ID = ?", mealID, userID).First(&meal).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "meal not found"})
 		return
 	}
+	if meal.MVersion != version {
+		versionConflict(c, meal.MVersion)
+		return
+	}
+
+	var intake models.DailyIntake
+	config.DB.First(&intake, "DI_ID = ?", meal.DailyIntakeID)
+
+	if !intakeWritable(intake) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "intake locked"})
+		return
+	}
 
 	var input MealInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -223,15 +417,59 @@ func EditMeal(c *gin.Context) {
 		return
 	}
 
+	calorieDiff := input.Calories - meal.MCalories
+	before := meal
+
 	meal.MFoodName = input.FoodName
 	meal.MCalories = input.Calories
 	meal.Time = input.Time
+	meal.MProtein = input.Protein
+	meal.MCarbs = input.Carbs
+	meal.MFat = input.Fat
+	meal.MVersion = version + 1
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// The version check in the WHERE keeps a concurrent edit from being overwritten.
+		result := tx.Model(&models.Meal{}).
+			Where("M_ID = ? AND M_Version = ?", meal.MID, version).
+			Updates(map[string]interface{}{
+				"M_FoodName": meal.MFoodName,
+				"M_Calories": meal.MCalories,
+				"time":       meal.Time,
+				"M_Protein":  meal.MProtein,
+				"M_Carbs":    meal.MCarbs,
+				"M_Fat":      meal.MFat,
+				"M_Version":  meal.MVersion,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if err := saveMealVersion(tx, before, userID); err != nil {
+			return err
+		}
+		return bumpIntake(tx, meal.DailyIntakeID, calorieDiff)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.Meal
+		config.DB.Select("M_Version").First(&current, "M_ID = ?", meal.MID)
+		versionConflict(c, current.MVersion)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	config.DB.Save(&meal)
+	recordAudit(c, "update", "meal", meal.MID, userID, before, meal)
+	checkGoalReached(meal.DailyIntakeID)
 
-	var intake models.DailyIntake
-	config.DB.Preload("Meals").Preload("Comments").First(&intake, "DI_ID = ?", meal.DailyIntakeID)
+	preloadIntake(config.DB).First(&intake, "DI_ID = ?", meal.DailyIntakeID)
+	decorateIntake(&intake)
 
+	c.Header("ETag", utils.ETag(intake.DIVersion))
 	c.JSON(http.StatusOK, intake)
 }
 
@@ -245,6 +483,11 @@ func LockIntake(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
 	var intake models.DailyIntake
 	err := config.DB.Where("DI_ID = ? AND CustomerUsers_U_ID = ?", diID, userID).First(&intake).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -252,13 +495,38 @@ func LockIntake(c *gin.Context) {
 		return
 	}
 
+	if intake.DIVersion != version {
+		versionConflict(c, intake.DIVersion)
+		return
+	}
+
 	if intake.DIIsLocked {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "already locked"})
 		return
 	}
 
+	before := intake
 	intake.DIIsLocked = true
-	config.DB.Save(&intake)
+	intake.DIVersion = version + 1
+	result := config.DB.Model(&models.DailyIntake{}).
+		Where("DI_ID = ? AND DI_Version = ?", intake.DIID, version).
+		Updates(map[string]interface{}{
+			"DI_isLocked": true,
+			"DI_Version":  intake.DIVersion,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		config.DB.Select("DI_Version").First(&intake, "DI_ID = ?", intake.DIID)
+		versionConflict(c, intake.DIVersion)
+		return
+	}
+
+	recordAudit(c, "lock", "daily_intake", intake.DIID, userID, before, intake)
+	events.Publish(events.IntakeLocked, gin.H{"di_id": intake.DIID, "date": intake.DIDate, "user_id": userID}, dayParticipants(userID, "")...)
 
-	c.JSON(http.StatusOK, gin.H{"message": "locked"})
+	c.Header("ETag", utils.ETag(intake.DIVersion))
+	c.JSON(http.StatusOK, gin.H{"message": "locked", "version": intake.DIVersion})
 }
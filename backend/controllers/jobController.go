@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/jobs"
+	"fp-pbkk/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAutoLockStatus(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var run models.JobRun
+	if err := config.DB.Where("JR_Name = ?", jobs.AutoLockJob).First(&run).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Auto-lock has not run yet"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": run})
+}
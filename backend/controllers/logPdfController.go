@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"fmt"
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/pdf"
+	"fp-pbkk/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	pdfMargin = 50.0
+	pdfBottom = pdf.PageHeight - 60
+)
+
+// logPage tracks where the next line of a log PDF goes and breaks pages as needed.
+type logPage struct {
+	doc *pdf.Document
+	y   float64
+}
+
+func (p *logPage) need(height float64) {
+	if p.y+height > pdfBottom {
+		p.doc.AddPage()
+		p.y = pdfMargin
+	}
+}
+
+func (p *logPage) line(size float64, bold bool, text string) {
+	p.need(size + 6)
+	p.y += size + 6
+	p.doc.Text(pdfMargin, p.y, size, bold, pdf.Fit(text, size, pdf.PageWidth-2*pdfMargin))
+}
+
+// row writes one table row with the given column x offsets.
+func (p *logPage) row(cols []float64, bold bool, cells ...string) {
+	p.need(16)
+	p.y += 16
+	for i, cell := range cells {
+		width := pdf.PageWidth - pdfMargin - cols[i]
+		if i+1 < len(cols) {
+			width = cols[i+1] - cols[i] - 6
+		}
+		p.doc.Text(cols[i], p.y, 9, bold, pdf.Fit(cell, 9, width))
+	}
+}
+
+func (p *logPage) rule() {
+	p.y += 4
+	p.doc.Line(pdfMargin, p.y, pdf.PageWidth-pdfMargin, p.y)
+}
+
+// calorieChart draws one bar per day with the BMR as a reference line.
+func calorieChart(p *logPage, logs []models.DailyIntake, bmr float64) {
+	const height = 200.0
+	p.need(height + 60)
+	p.line(13, true, "Daily calories")
+	top := p.y + 14
+	width := pdf.PageWidth - 2*pdfMargin
+
+	max := bmr
+	for _, l := range logs {
+		if float64(l.DITotalCalories) > max {
+			max = float64(l.DITotalCalories)
+		}
+	}
+	if max <= 0 {
+		max = 1
+	}
+
+	slot := width / float64(len(logs))
+	for i, l := range logs {
+		h := float64(l.DITotalCalories) / max * height
+		x := pdfMargin + float64(i)*slot
+		r, g, b := 0.35, 0.65, 0.40
+		if utils.IntakeStatus(l.DITotalCalories, bmr) != "Normal" {
+			r, g, b = 0.85, 0.45, 0.30
+		}
+		p.doc.Rect(x+slot*0.15, top+height-h, slot*0.7, h, r, g, b)
+		if len(logs) <= 16 {
+			p.doc.Text(x+slot*0.15, top+height+12, 7, false, l.DIDate.Format("01-02"))
+		}
+	}
+
+	p.doc.Line(pdfMargin, top+height, pdfMargin+width, top+height)
+	if bmr > 0 {
+		y := top + height - bmr/max*height
+		p.doc.Line(pdfMargin, y, pdfMargin+width, y)
+		p.doc.Text(pdfMargin+width-70, y-3, 8, false, fmt.Sprintf("BMR %.0f", bmr))
+	}
+	p.y = top + height + 20
+}
+
+// GET /logs/:user_id/pdf?from=&to=
+func GetUserLogsPDF(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userID := c.Param("user_id")
+	if !isAssignedNutritionist(c.GetString("user_id"), userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Client is not assigned to you"})
+		return
+	}
+
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	var client models.User
+	if err := config.DB.Where("U_ID = ?", userID).First(&client).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var logs []models.DailyIntake
+	if err := preloadIntake(config.DB).
+		Preload("Meals", func(db *gorm.DB) *gorm.DB { return db.Order("time") }).
+		Where("CustomerUsers_U_ID = ? AND DI_Date BETWEEN ? AND ?", userID, from.Format("2006-01-02"), to.Format("2006-01-02")).
+		Order("DI_Date").
+		Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs"})
+		return
+	}
+
+	doc := pdf.New()
+	p := &logPage{doc: doc, y: pdfMargin}
+
+	p.line(18, true, "CaloriSync intake log")
+	p.line(11, false, fmt.Sprintf("Client: %s    Period: %s to %s", client.Username, from.Format("2006-01-02"), to.Format("2006-01-02")))
+	p.line(11, false, fmt.Sprintf("BMR: %.0f kcal    BMI: %.1f    Weight: %.1f kg", client.BMR, client.BMI, client.Weight))
+
+	total := 0
+	for _, l := range logs {
+		total += l.DITotalCalories
+	}
+	if len(logs) > 0 {
+		p.line(11, false, fmt.Sprintf("Days: %d    Total: %d kcal    Average: %.0f kcal/day", len(logs), total, float64(total)/float64(len(logs))))
+		p.y += 10
+		calorieChart(p, logs, client.BMR)
+	} else {
+		p.line(11, false, "No days logged in this period.")
+	}
+
+	cols := []float64{pdfMargin, pdfMargin + 50, pdfMargin + 260, pdfMargin + 320, pdfMargin + 370, pdfMargin + 420}
+	for _, l := range logs {
+		p.need(80)
+		p.y += 12
+		p.line(13, true, fmt.Sprintf("%s  -  %d kcal (%s)", l.DIDate.Format("Monday, 2 Jan 2006"), l.DITotalCalories, utils.IntakeStatus(l.DITotalCalories, client.BMR)))
+		p.row(cols, true, "Time", "Food", "kcal", "Protein", "Carbs", "Fat")
+		p.rule()
+		for _, m := range l.Meals {
+			p.row(cols, false, m.Time, m.MFoodName, fmt.Sprint(m.MCalories),
+				fmt.Sprintf("%.1f g", m.MProtein), fmt.Sprintf("%.1f g", m.MCarbs), fmt.Sprintf("%.1f g", m.MFat))
+			for _, cm := range m.Comments {
+				p.row(cols, false, "", fmt.Sprintf("  %s: %s", cm.Author.Username, cm.CContent))
+			}
+		}
+		if len(l.Meals) == 0 {
+			p.row(cols, false, "", "No meals logged")
+		}
+		p.rule()
+		p.row(cols, true, "", "Total", fmt.Sprint(l.DITotalCalories))
+
+		for _, cm := range l.Comments {
+			p.line(9, false, fmt.Sprintf("Comment by %s: %s", cm.Author.Username, cm.CContent))
+		}
+	}
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_%s_%s.pdf"`,
+		utils.SafeFilename(client.Username), from.Format("20060102"), to.Format("20060102")))
+	c.Status(http.StatusOK)
+	doc.WriteTo(c.Writer)
+}
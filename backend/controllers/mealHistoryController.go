@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// saveMealVersion snapshots a meal as it was before an edit. Call it after the
+// edit's conditional update: that row lock is held until commit, so concurrent
+// edits of the same meal number their snapshots one after the other.
+func saveMealVersion(tx *gorm.DB, meal models.Meal, editedBy string) error {
+	var last int
+	if err := tx.Model(&models.MealVersion{}).
+		Where("Meals_M_ID = ?", meal.MID).
+		Select("COALESCE(MAX(MV_Version), 0)").
+		Scan(&last).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&models.MealVersion{
+		MealID:     meal.MID,
+		MVVersion:  last + 1,
+		MVFoodName: meal.MFoodName,
+		MVCalories: meal.MCalories,
+		MVProtein:  meal.MProtein,
+		MVCarbs:    meal.MCarbs,
+		MVFat:      meal.MFat,
+		MVTime:     meal.Time,
+		EditedBy:   editedBy,
+	}).Error
+}
+
+// flagEditsAfterComment marks meals that were edited after the day's first
+// nutritionist comment.
+func flagEditsAfterComment(intake *models.DailyIntake) {
+	comments := intake.Comments
+	for _, m := range intake.Meals {
+		comments = append(comments, m.Comments...)
+	}
+
+	var firstComment time.Time
+	for _, cm := range comments {
+		if cm.AuthorRole == "Nutritionist" && !cm.CreatedAt.IsZero() && (firstComment.IsZero() || cm.CreatedAt.Before(firstComment)) {
+			firstComment = cm.CreatedAt
+		}
+	}
+	if firstComment.IsZero() || len(intake.Meals) == 0 {
+		return
+	}
+
+	mealIDs := make([]string, len(intake.Meals))
+	for i, m := range intake.Meals {
+		mealIDs[i] = m.MID
+	}
+
+	var edited []string
+	config.DB.Model(&models.MealVersion{}).
+		Distinct("Meals_M_ID").
+		Where("Meals_M_ID IN ? AND MV_CreatedAt > ?", mealIDs, firstComment).
+		Pluck("Meals_M_ID", &edited)
+
+	editedSet := map[string]bool{}
+	for _, id := range edited {
+		editedSet[id] = true
+	}
+	for i := range intake.Meals {
+		if editedSet[intake.Meals[i].MID] {
+			intake.Meals[i].EditedAfterComment = true
+			intake.EditedAfterComment = true
+		}
+	}
+}
+
+// GET MEAL HISTORY
+// Available to the meal's owner and to their assigned nutritionists.
+func GetMealHistory(c *gin.Context) {
+	userID := c.GetString("user_id")
+	mealID := c.Param("meal_id")
+
+	var meal models.Meal
+	if err := config.DB.Unscoped().Where("M_ID = ?", mealID).First(&meal).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "meal not found"})
+		return
+	}
+
+	if meal.UID != userID && !isAssignedNutritionist(userID, meal.UID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to view this meal"})
+		return
+	}
+
+	var versions []models.MealVersion
+	if err := config.DB.
+		Where("Meals_M_ID = ?", mealID).
+		Order("MV_Version ASC").
+		Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", utils.ETag(meal.MVersion))
+	c.JSON(http.StatusOK, gin.H{
+		"current":  meal,
+		"versions": versions,
+	})
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var mealSlots = map[string]bool{
+	"breakfast": true,
+	"lunch":     true,
+	"dinner":    true,
+	"snack":     true,
+}
+
+type PlannedMealInput struct {
+	Date     string `json:"date" binding:"required"` // YYYY-MM-DD
+	Slot     string `json:"slot" binding:"required"`
+	FoodName string `json:"food_name" binding:"required"`
+	Portion  string `json:"portion"`
+	Calories int    `json:"calories"`
+}
+
+type MealPlanInput struct {
+	UserID    string             `json:"user_id" binding:"required"`
+	Name      string             `json:"name"`
+	StartDate string             `json:"start_date" binding:"required"`
+	EndDate   string             `json:"end_date" binding:"required"`
+	Meals     []PlannedMealInput `json:"meals" binding:"required,dive"`
+}
+
+type plannedDay struct {
+	UserID   string
+	PlanDate time.Time
+	Calories int
+}
+
+// adherence scores how close the logged calories came to the plan, from 0 to 100.
+func adherence(logged int, planned int) *float64 {
+	if planned <= 0 {
+		return nil
+	}
+
+	score := 100 * (1 - math.Abs(float64(logged-planned))/float64(planned))
+	if score < 0 {
+		score = 0
+	}
+	score = math.Round(score*10) / 10
+	return &score
+}
+
+// attachPlan fills the planned-vs-logged fields of a day from the client's meal plans.
+func attachPlan(intake *models.DailyIntake) {
+	var planned []models.PlannedMeal
+	config.DB.
+		Joins("JOIN meal_plans ON meal_plans.MP_ID = planned_meals.Meal_Plans_MP_ID").
+		Where("meal_plans.CustomerUsers_U_ID = ? AND planned_meals.PM_Date = ?",
+			intake.CustomerUserID, intake.DIDate.Format("2006-01-02")).
+		Order("FIELD(planned_meals.PM_Slot, 'breakfast', 'lunch', 'snack', 'dinner')").
+		Find(&planned)
+
+	total := 0
+	for _, p := range planned {
+		total += p.PMCalories
+	}
+
+	intake.PlannedMeals = planned
+	intake.PlannedCalories = total
+	intake.Adherence = adherence(intake.DITotalCalories, total)
+}
+
+// plannedCaloriesByDay sums planned calories per client and day, keyed by "user_id|YYYY-MM-DD".
+func plannedCaloriesByDay(userIDs []string) map[string]int {
+	out := map[string]int{}
+	if len(userIDs) == 0 {
+		return out
+	}
+
+	var rows []plannedDay
+	config.DB.Model(&models.PlannedMeal{}).
+		Select("meal_plans.CustomerUsers_U_ID AS user_id, planned_meals.PM_Date AS plan_date, SUM(planned_meals.PM_Calories) AS calories").
+		Joins("JOIN meal_plans ON meal_plans.MP_ID = planned_meals.Meal_Plans_MP_ID").
+		Where("meal_plans.CustomerUsers_U_ID IN ?", userIDs).
+		Group("meal_plans.CustomerUsers_U_ID, planned_meals.PM_Date").
+		Scan(&rows)
+
+	for _, r := range rows {
+		out[r.UserID+"|"+r.PlanDate.Format("2006-01-02")] = r.Calories
+	}
+	return out
+}
+
+func CreateMealPlan(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	nutritionistID := c.GetString("user_id")
+
+	var input MealPlanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isAssignedNutritionist(nutritionistID, input.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Client is not assigned to you"})
+		return
+	}
+
+	start, err := time.Parse("2006-01-02", input.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_date format"})
+		return
+	}
+	end, err := time.Parse("2006-01-02", input.EndDate)
+	if err != nil || end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_date"})
+		return
+	}
+
+	plan := models.MealPlan{
+		MPID:           uuid.New().String(),
+		MPName:         input.Name,
+		MPStartDate:    start,
+		MPEndDate:      end,
+		NutritionistID: nutritionistID,
+		CustomerUserID: input.UserID,
+	}
+
+	for _, m := range input.Meals {
+		date, err := time.Parse("2006-01-02", m.Date)
+		if err != nil || date.Before(start) || date.After(end) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "meal date " + m.Date + " is outside the plan"})
+			return
+		}
+		if !mealSlots[m.Slot] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "slot must be breakfast, lunch, dinner or snack"})
+			return
+		}
+
+		plan.PlannedMeals = append(plan.PlannedMeals, models.PlannedMeal{
+			PMID:       uuid.New().String(),
+			PMDate:     date,
+			PMSlot:     m.Slot,
+			PMFoodName: m.FoodName,
+			PMPortion:  m.Portion,
+			PMCalories: m.Calories,
+		})
+	}
+
+	if err := config.DB.Create(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create meal plan"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Meal plan created", "data": plan})
+}
+
+func GetMealPlans(c *gin.Context) {
+	role, _ := c.Get("role")
+	userID := c.GetString("user_id")
+
+	query := config.DB.
+		Preload("PlannedMeals", func(db *gorm.DB) *gorm.DB {
+			return db.Order("PM_Date, FIELD(PM_Slot, 'breakfast', 'lunch', 'snack', 'dinner')")
+		}).
+		Order("MP_StartDate DESC")
+
+	if role == "Nutritionist" {
+		query = query.Where("NutritionistUsers_U_ID = ?", userID)
+		if client := c.Query("user_id"); client != "" {
+			query = query.Where("CustomerUsers_U_ID = ?", client)
+		}
+	} else {
+		query = query.Where("CustomerUsers_U_ID = ?", userID)
+	}
+
+	var plans []models.MealPlan
+	if err := query.Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get meal plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": plans})
+}
+
+func DeleteMealPlan(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var plan models.MealPlan
+	if err := config.DB.Where("MP_ID = ?", c.Param("mp_id")).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meal plan not found"})
+		return
+	}
+
+	if plan.NutritionistID != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own meal plans"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("Meal_Plans_MP_ID = ?", plan.MPID).Delete(&models.PlannedMeal{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&plan).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete meal plan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Meal plan deleted"})
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"errors"
+	"fp-pbkk/config"
+	"fp-pbkk/events"
+	"fp-pbkk/middleware"
+	"fp-pbkk/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
+)
+
+const maxMessageLength = 2000
+
+// chatAllowed reports whether two users may message each other: one has to be a
+// nutritionist the other is assigned to.
+func chatAllowed(a string, b string) bool {
+	return a != b && (isAssignedNutritionist(a, b) || isAssignedNutritionist(b, a))
+}
+
+// chatFrame is what clients send over the socket.
+//
+//	{"type": "send", "to": "<user id>", "content": "..."}
+//	{"type": "delivered", "id": 42}    the message reached this device
+//	{"type": "read", "peer": "<user id>"} everything from peer has been read
+//	{"type": "typing", "to": "<user id>"}
+type chatFrame struct {
+	Type    string `json:"type"`
+	To      string `json:"to"`
+	Peer    string `json:"peer"`
+	ID      uint   `json:"id"`
+	Content string `json:"content"`
+}
+
+func sendMessage(userID string, frame chatFrame) (models.DirectMessage, string) {
+	content := strings.TrimSpace(frame.Content)
+	if content == "" || len(content) > maxMessageLength {
+		return models.DirectMessage{}, "content is required and limited to 2000 characters"
+	}
+	if !chatAllowed(userID, frame.To) {
+		return models.DirectMessage{}, "you can only message your nutritionist or assigned clients"
+	}
+
+	msg := models.DirectMessage{SenderID: userID, RecipientID: frame.To, DMContent: content}
+	if err := config.DB.Create(&msg).Error; err != nil {
+		return msg, "failed to send message"
+	}
+
+	// The sender gets it too, so their other devices stay in sync.
+	events.Publish(events.MessageNew, msg, msg.RecipientID, msg.SenderID)
+	return msg, ""
+}
+
+func markDelivered(userID string, id uint) {
+	var msg models.DirectMessage
+	if err := config.DB.Where("DM_ID = ? AND DM_RecipientID = ?", id, userID).First(&msg).Error; err != nil {
+		return
+	}
+	if msg.DMDeliveredAt != nil {
+		return
+	}
+
+	now := time.Now()
+	config.DB.Model(&msg).Update("DM_DeliveredAt", now)
+	events.Publish(events.MessageDelivered, gin.H{"dm_id": msg.DMID, "delivered_at": now}, msg.SenderID)
+}
+
+func markRead(userID string, peer string) {
+	now := time.Now()
+	var lastID uint
+	config.DB.Model(&models.DirectMessage{}).
+		Select("COALESCE(MAX(DM_ID), 0)").
+		Where("DM_SenderID = ? AND DM_RecipientID = ? AND DM_ReadAt IS NULL", peer, userID).
+		Scan(&lastID)
+	if lastID == 0 {
+		return
+	}
+
+	config.DB.Model(&models.DirectMessage{}).
+		Where("DM_SenderID = ? AND DM_RecipientID = ? AND DM_ReadAt IS NULL AND DM_ID <= ?", peer, userID, lastID).
+		Updates(map[string]interface{}{
+			"DM_ReadAt":      now,
+			"DM_DeliveredAt": gorm.Expr("COALESCE(DM_DeliveredAt, ?)", now),
+		})
+
+	events.Publish(events.MessageRead, gin.H{"reader_id": userID, "up_to": lastID, "read_at": now}, peer, userID)
+}
+
+// GET /messages/ws
+// WebSocket for direct messages. Everything published to the user (new messages,
+// receipts, typing, and the events of GET /events) is forwarded on the socket.
+// Browsers cannot set headers on a WebSocket, so they open it with ?ticket= from
+// POST /stream-tickets. The session is checked again before every frame and every
+// EVENTS_HEARTBEAT_SECONDS, and the socket is closed once it has been signed out.
+func ChatSocket(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	server := websocket.Server{
+		// Browsers always send Origin, and a page on another site must not get a
+		// socket even if it got hold of a ticket. Other clients send none.
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			origin := r.Header.Get("Origin")
+			if origin == "" || slices.Contains(config.AllowedOrigins(), origin) {
+				return nil
+			}
+			return errors.New("origin not allowed")
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ws.MaxPayloadBytes = 64 << 10
+
+			stream, unsubscribe := events.Subscribe(userID)
+			defer unsubscribe()
+
+			heartbeat := time.NewTicker(time.Duration(config.EnvInt("EVENTS_HEARTBEAT_SECONDS", 25)) * time.Second)
+			defer heartbeat.Stop()
+
+			// Only this goroutine writes to the socket.
+			replies := make(chan events.Event, 8)
+			done := make(chan struct{})
+			go func() {
+				defer ws.Close()
+				for {
+					select {
+					case <-done:
+						return
+					case <-heartbeat.C:
+						if !middleware.SessionStillActive(c) {
+							return
+						}
+					case ev := <-stream:
+						if websocket.JSON.Send(ws, ev) != nil {
+							return
+						}
+					case ev := <-replies:
+						if websocket.JSON.Send(ws, ev) != nil {
+							return
+						}
+					}
+				}
+			}()
+			defer close(done)
+
+			reply := func(eventType string, data interface{}) {
+				select {
+				case replies <- events.Event{Type: eventType, Data: data, At: time.Now()}:
+				default:
+				}
+			}
+
+			for {
+				var frame chatFrame
+				if err := websocket.JSON.Receive(ws, &frame); err != nil {
+					return
+				}
+				if !middleware.SessionStillActive(c) {
+					return
+				}
+
+				switch frame.Type {
+				case "send":
+					if _, errMsg := sendMessage(userID, frame); errMsg != "" {
+						reply("error", gin.H{"error": errMsg})
+					}
+				case "delivered":
+					markDelivered(userID, frame.ID)
+				case "read":
+					markRead(userID, frame.Peer)
+				case "typing":
+					if chatAllowed(userID, frame.To) {
+						events.Publish(events.MessageTyping, gin.H{"from": userID}, frame.To)
+					}
+				default:
+					reply("error", gin.H{"error": "unknown frame type " + frame.Type})
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// GET /messages/:user_id?before=<dm_id>&limit=50
+// Conversation history with one user, newest first. Pass next_before back as
+// before to load older messages.
+func GetMessages(c *gin.Context) {
+	userID := c.GetString("user_id")
+	peer := c.Param("user_id")
+
+	if !chatAllowed(userID, peer) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can only message your nutritionist or assigned clients"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := config.DB.
+		Where("(DM_SenderID = ? AND DM_RecipientID = ?) OR (DM_SenderID = ? AND DM_RecipientID = ?)", userID, peer, peer, userID)
+	if before, err := strconv.ParseUint(c.Query("before"), 10, 64); err == nil {
+		query = query.Where("DM_ID < ?", before)
+	}
+
+	var messages []models.DirectMessage
+	if err := query.Order("DM_ID DESC").Limit(limit).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var nextBefore *uint
+	if len(messages) == limit {
+		nextBefore = &messages[len(messages)-1].DMID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": messages, "next_before": nextBefore})
+}
+
+// POST /messages/:user_id
+// REST fallback for sending, for clients without a socket open.
+func PostMessage(c *gin.Context) {
+	var input struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg, errMsg := sendMessage(c.GetString("user_id"), chatFrame{To: c.Param("user_id"), Content: input.Content})
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	c.JSON(http.StatusCreated, msg)
+}
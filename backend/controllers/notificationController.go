@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/notify"
+	"fp-pbkk/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dayLink is the frontend page where the recipient sees the client's day.
+func dayLink(recipientID string, clientID string) string {
+	if recipientID == clientID {
+		return "/dashboard-user/intakeLogs"
+	}
+	return "/dashboard-nutritionist/logs/" + clientID
+}
+
+// checkGoalReached notifies the client the first time a day's total lands in the
+// normal range around their BMR.
+func checkGoalReached(diID string) {
+	var intake models.DailyIntake
+	if err := config.DB.Preload("CustomerUser").Where("DI_ID = ?", diID).First(&intake).Error; err != nil {
+		return
+	}
+	if intake.CustomerUser.BMR <= 0 || utils.IntakeStatus(intake.DITotalCalories, intake.CustomerUser.BMR) != "Normal" {
+		return
+	}
+
+	notify.Send(models.Notification{
+		UserID: intake.CustomerUserID,
+		NType:  notify.GoalReached,
+		NTitle: "Goal reached for " + intake.DIDate.Format("2 Jan 2006"),
+		NBody:  strconv.Itoa(intake.DITotalCalories) + " kcal logged, right on target.",
+		NLink:  dayLink(intake.CustomerUserID, intake.CustomerUserID),
+		NKey:   notify.Key(notify.GoalReached, diID),
+	})
+}
+
+// GET /notifications?unread=true&before=<n_id>&limit=50
+func GetNotifications(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := config.DB.Where("U_ID = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("N_ReadAt IS NULL")
+	}
+	if before, err := strconv.ParseUint(c.Query("before"), 10, 64); err == nil {
+		query = query.Where("N_ID < ?", before)
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("N_ID DESC").Limit(limit).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var unread int64
+	config.DB.Model(&models.Notification{}).Where("U_ID = ? AND N_ReadAt IS NULL", userID).Count(&unread)
+
+	c.JSON(http.StatusOK, gin.H{"data": notifications, "unread_count": unread})
+}
+
+// PATCH /notifications/:id/read
+func MarkNotificationRead(c *gin.Context) {
+	var notification models.Notification
+	if err := config.DB.Where("N_ID = ? AND U_ID = ?", c.Param("id"), c.GetString("user_id")).First(&notification).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+
+	if notification.NReadAt == nil {
+		now := time.Now()
+		notification.NReadAt = &now
+		if err := config.DB.Model(&notification).Update("N_ReadAt", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, notification)
+}
+
+// POST /notifications/read-all
+func MarkAllNotificationsRead(c *gin.Context) {
+	result := config.DB.Model(&models.Notification{}).
+		Where("U_ID = ? AND N_ReadAt IS NULL", c.GetString("user_id")).
+		Update("N_ReadAt", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "all notifications marked as read", "updated": result.RowsAffected})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"fp-pbkk/config"
 	"fp-pbkk/models"
+	"fp-pbkk/utils"
 	"net/http"
 	"time"
 
@@ -17,6 +18,8 @@ type IntakeDashboardDTO struct {
 	BMR            float64   `json:"bmr"`
 	Status         string    `json:"status"`
 	CustomerUserID string    `json:"user_id"`
+	Adherence      *float64  `json:"adherence,omitempty"`
+	UnreadComments int       `json:"unread_comments"`
 }
 
 func GetDashboardIntakes(c *gin.Context) {
@@ -29,9 +32,14 @@ func GetDashboardIntakes(c *gin.Context) {
 	startDate := c.Query("start")
 	endDate := c.Query("end")
 
+	clients := config.DB.Model(&models.ClientAssignment{}).Scopes(models.AcceptedAssignments).
+		Select("CustomerUsers_U_ID").
+		Where("NutritionistUsers_U_ID = ?", c.GetString("user_id"))
+
 	var intakes []models.DailyIntake
 	query := config.DB.
 		Preload("CustomerUser").
+		Where("CustomerUsers_U_ID IN (?)", clients).
 		Order("DI_Date DESC")
 
 	if startDate != "" && endDate != "" {
@@ -44,16 +52,22 @@ func GetDashboardIntakes(c *gin.Context) {
 		return
 	}
 
+	var userIDs, diIDs []string
+	seen := map[string]bool{}
+	for _, x := range intakes {
+		diIDs = append(diIDs, x.DIID)
+		if !seen[x.CustomerUserID] {
+			seen[x.CustomerUserID] = true
+			userIDs = append(userIDs, x.CustomerUserID)
+		}
+	}
+	planned := plannedCaloriesByDay(userIDs)
+	unread := unreadCounts(c.GetString("user_id"), diIDs)
+
 	var output []IntakeDashboardDTO
 
 	for _, x := range intakes {
-		status := "Normal"
-
-		if float64(x.DITotalCalories) > x.CustomerUser.BMR {
-			status = "Above BMR"
-		} else if float64(x.DITotalCalories) < x.CustomerUser.BMR-200 {
-			status = "Below BMR"
-		}
+		status := utils.IntakeStatus(x.DITotalCalories, x.CustomerUser.BMR)
 
 		output = append(output, IntakeDashboardDTO{
 			DIID:           x.DIID,
@@ -63,6 +77,8 @@ func GetDashboardIntakes(c *gin.Context) {
 			BMR:            x.CustomerUser.BMR,
 			Status:         status,
 			CustomerUserID: x.CustomerUserID,
+			Adherence:      adherence(x.DITotalCalories, planned[x.CustomerUserID+"|"+x.DIDate.Format("2006-01-02")]),
+			UnreadComments: unread[x.DIID],
 		})
 	}
 
@@ -73,12 +89,14 @@ func GetUserLogs(c *gin.Context) {
 	userID := c.Param("user_id")
 	date := c.Query("date")
 
+	if userID != c.GetString("user_id") && !isAssignedNutritionist(c.GetString("user_id"), userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Client is not assigned to you"})
+		return
+	}
+
 	var logs []models.DailyIntake
 
-	query := config.DB.
-		Preload("Meals").
-		Preload("Comments").
-		Preload("Comments.Nutritionist").
+	query := preloadIntake(config.DB).
 		Where("CustomerUsers_U_ID = ?", userID)
 
 	if date != "" {
@@ -94,42 +112,52 @@ func GetUserLogs(c *gin.Context) {
 		return
 	}
 
+	diIDs := make([]string, len(logs))
+	for i := range logs {
+		diIDs[i] = logs[i].DIID
+	}
+	unread := unreadCounts(c.GetString("user_id"), diIDs)
+	for i := range logs {
+		flagEditsAfterComment(&logs[i])
+		logs[i].UnreadComments = unread[logs[i].DIID]
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    logs,
 	})
 }
 
-func AddComment(c *gin.Context) {
-	nutritionistID, _ := c.Get("user_id")
+// intakeOwner returns the client a day belongs to.
+func intakeOwner(diID string) string {
+	var intake models.DailyIntake
+	config.DB.Select("DI_ID", "CustomerUsers_U_ID").Where("DI_ID = ?", diID).First(&intake)
+	return intake.CustomerUserID
+}
 
+// Kept for the nutritionist pages; AddDayComment is the same for both roles.
+func AddComment(c *gin.Context) {
 	var input struct {
-		DIID    string `json:"di_id"`
-		Content string `json:"content"`
+		DIID string `json:"di_id" binding:"required"`
+		CommentInput
 	}
 
-	if err := c.BindJSON(&input); err != nil {
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
 		return
 	}
 
-	comment := models.Comment{
-		CContent:       input.Content,
-		DailyIntakeID:  input.DIID,
-		NutritionistID: nutritionistID.(string),
-	}
-
-	if err := config.DB.Create(&comment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+	comment, ok := createComment(c, input.DIID, input.CommentInput)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Comment added"})
+	c.JSON(http.StatusOK, gin.H{"message": "Comment added", "data": comment})
 }
 
 func UpdateComment(c *gin.Context) {
 	cid := c.Param("id")
-	nutritionistID, _ := c.Get("user_id")
+	authorID := c.GetString("user_id")
 
 	var body struct {
 		Content string `json:"content"`
@@ -147,22 +175,25 @@ func UpdateComment(c *gin.Context) {
 		return
 	}
 
-	if comment.NutritionistID != nutritionistID.(string) {
+	if comment.AuthorID != authorID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own comments"})
 		return
 	}
 
+	before := comment
 	if err := config.DB.Model(&comment).Update("C_Content", body.Content).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
 		return
 	}
 
+	recordAudit(c, "update", "comment", cid, intakeOwner(comment.DailyIntakeID), before, comment)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment updated"})
 }
 
 func DeleteComment(c *gin.Context) {
 	cid := c.Param("id")
-	nutritionistID, _ := c.Get("user_id")
+	authorID := c.GetString("user_id")
 
 	// Check ownership before deleting
 	var comment models.Comment
@@ -171,7 +202,7 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
-	if comment.NutritionistID != nutritionistID.(string) {
+	if comment.AuthorID != authorID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own comments"})
 		return
 	}
@@ -181,5 +212,36 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, "delete", "comment", cid, intakeOwner(comment.DailyIntakeID), comment, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
 }
+
+func RestoreComment(c *gin.Context) {
+	cid := c.Param("id")
+	authorID := c.GetString("user_id")
+
+	retention := time.Duration(config.EnvInt("SOFT_DELETE_RETENTION_DAYS", 30)) * 24 * time.Hour
+
+	var comment models.Comment
+	if err := config.DB.Unscoped().
+		Where("c_id = ? AND C_DeletedAt > ?", cid, time.Now().Add(-retention)).
+		First(&comment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No restorable comment found"})
+		return
+	}
+
+	if comment.AuthorID != authorID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only restore your own comments"})
+		return
+	}
+
+	if err := config.DB.Unscoped().Model(&comment).Update("C_DeletedAt", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore comment"})
+		return
+	}
+
+	recordAudit(c, "restore", "comment", cid, intakeOwner(comment.DailyIntakeID), nil, comment)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment restored"})
+}
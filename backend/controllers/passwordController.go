@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fp-pbkk/config"
+	"fp-pbkk/mailer"
+	"fp-pbkk/models"
+	"fp-pbkk/passwords"
+	"fp-pbkk/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// weakPassword answers 400 with every broken rule when the password does not meet
+// the policy in the passwords package.
+func weakPassword(c *gin.Context, password string, username string) bool {
+	problems := passwords.Check(password, username)
+	if len(problems) == 0 {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Password " + strings.Join(problems, "; "),
+		"details": problems,
+	})
+	return true
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// setPassword stores a new password hash and bumps the session version, which
+// signs the user out of every existing token.
+func setPassword(tx *gorm.DB, user *models.User, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.Password = string(hashed)
+	user.SessionVersion++
+	return tx.Model(user).Updates(map[string]interface{}{
+		"U_Password":       user.Password,
+		"U_SessionVersion": user.SessionVersion,
+	}).Error
+}
+
+// PUT /password
+// Changes the password of the logged-in user. Other sessions are signed out; the
+// response carries a fresh token for this one.
+func ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("U_ID = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+		return
+	}
+
+	if weakPassword(c, input.NewPassword, user.Username) {
+		return
+	}
+
+	if err := setPassword(config.DB, &user, input.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	recordAudit(c, "change_password", "user", user.UID, user.UID, nil, nil)
+
+	token, err := utils.GenerateToken(user.UID, user.Role, user.SessionVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed", "token": token})
+}
+
+// POST /password/forgot
+// Emails a reset link to the account's address, or to every account using the
+// email address given. The answer is the same whether or not the account exists,
+// and is sent before any account is looked up, so neither it nor its timing can
+// be used to probe for usernames. Requests are throttled like logins, where every
+// request counts as a failure, per IP (RESET_MAX_IP_REQUESTS, default 10) and per
+// account (RESET_MAX_REQUESTS, default 3); an account over its limit is skipped
+// silently.
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Username == "" && input.Email == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username or email required"})
+		return
+	}
+
+	reserved, ok := reserveAttempt(c, []throttleKey{
+		{key: "reset:ip:" + c.ClientIP(), limit: config.EnvInt("RESET_MAX_IP_REQUESTS", 10)},
+	})
+	if !ok {
+		return
+	}
+	reserved.failed("")
+
+	go sendResetLinks(c.Copy(), input.Username, input.Email)
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists and has an email address, a reset link is on its way."})
+}
+
+// sendResetLinks creates a reset token for each active account with the username
+// or email and queues its email. It runs after ForgotPassword has answered, so
+// problems are only logged.
+func sendResetLinks(c *gin.Context, username string, email string) {
+	var users []models.User
+	query := config.DB.Where("U_DeactivatedAt IS NULL AND U_Email <> ''")
+	if email != "" {
+		query = query.Where("U_Email = ?", email)
+	} else {
+		query = query.Where("U_Username = ?", username)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		log.Printf("password reset: find accounts: %v", err)
+		return
+	}
+
+	minutes := config.EnvInt("PASSWORD_RESET_MINUTES", 60)
+	for _, user := range users {
+		reserved, _, err := reserveKeys(c, []throttleKey{
+			{key: "reset:user:" + user.UID, limit: config.EnvInt("RESET_MAX_REQUESTS", 3), account: true},
+		})
+		if err != nil {
+			continue
+		}
+		reserved.failed(user.UID)
+
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			log.Printf("password reset for %s: create token: %v", user.UID, err)
+			return
+		}
+		token := hex.EncodeToString(raw)
+
+		reset := models.PasswordReset{
+			UserID:      user.UID,
+			PRTokenHash: hashResetToken(token),
+			PRExpiresAt: time.Now().Add(time.Duration(minutes) * time.Minute),
+		}
+		if err := config.DB.Create(&reset).Error; err != nil {
+			log.Printf("password reset for %s: save token: %v", user.UID, err)
+			continue
+		}
+
+		if _, err := mailer.Enqueue("password_reset", user.UID, user.Email, mailer.PasswordResetData{
+			Name:      user.Username,
+			Link:      mailer.Link("/authentication/reset-password?token=" + token),
+			ExpiresIn: strconv.Itoa(minutes) + " minutes",
+		}, nil); err != nil {
+			log.Printf("password reset for %s: queue email: %v", user.UID, err)
+		}
+	}
+}
+
+// POST /password/reset
+// Sets a new password with a token from the reset email. The token works once,
+// every other open reset link of the user is voided, all sessions end, and a
+// login lockout of the account is lifted.
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reset models.PasswordReset
+	if err := config.DB.
+		Where("PR_TokenHash = ? AND PR_UsedAt IS NULL AND PR_ExpiresAt > ?", hashResetToken(input.Token), time.Now()).
+		First(&reset).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	}
+
+	var owner models.User
+	config.DB.Select("U_Username").Where("U_ID = ?", reset.UserID).First(&owner)
+	if weakPassword(c, input.NewPassword, owner.Username) {
+		return
+	}
+
+	var user models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the token first so two concurrent resets cannot both use it.
+		claimed := tx.Model(&models.PasswordReset{}).
+			Where("PR_ID = ? AND PR_UsedAt IS NULL", reset.PRID).
+			Update("PR_UsedAt", time.Now())
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("U_ID = ? AND PR_UsedAt IS NULL", reset.UserID).
+			Update("PR_UsedAt", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("U_ID = ?", reset.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("LT_Key = ?", "user:"+strings.ToLower(user.Username)).Delete(&models.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+		return setPassword(tx, &user, input.NewPassword)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.Set("user_id", user.UID)
+	c.Set("role", user.Role)
+	recordAudit(c, "reset_password", "user", user.UID, user.UID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset, you can log in with the new password"})
+}
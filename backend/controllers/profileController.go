@@ -4,6 +4,7 @@ import (
 	"fp-pbkk/config"
 	"fp-pbkk/models"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +16,10 @@ type ProfileInput struct {
 	Gender string  `json:"gender"`
 	BMI    float64 `json:"bmi"`
 	BMR    float64 `json:"bmr"`
+	// Optional IANA time zone used to decide which day meals belong to.
+	TimeZone string `json:"time_zone"`
+	// Optional address for email notifications; send "-" to remove it.
+	Email string `json:"email" binding:"omitempty,email|eq=-"`
 }
 
 func UpdateProfile(c *gin.Context) {
@@ -36,17 +41,35 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	if input.TimeZone != "" {
+		if _, err := time.LoadLocation(input.TimeZone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone: " + input.TimeZone})
+			return
+		}
+	}
+
 	var user models.User
 	if err := config.DB.Where("U_ID = ?", uid).First(&user).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User profile not found"})
 		return
 	}
 
+	weightChanged := user.Weight != input.Weight
+	before := user
+
 	// Update
 	user.Height = input.Height
 	user.Weight = input.Weight
 	user.Age = input.Age
 	user.Gender = input.Gender
+	if input.TimeZone != "" {
+		user.TimeZone = input.TimeZone
+	}
+	if input.Email == "-" {
+		user.Email = ""
+	} else if input.Email != "" {
+		user.Email = input.Email
+	}
 
 	// Recalculate BMI/BMR
 	heightM := user.Height / 100
@@ -63,6 +86,13 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, "update", "user", user.UID, user.UID, before, user)
+
+	// Keep a weight history for progress reports
+	if weightChanged && user.Weight > 0 {
+		config.DB.Create(&models.WeightLog{UserID: user.UID, WLWeight: user.Weight})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Profile change successful!",
 		"data":    user,
@@ -86,6 +116,14 @@ func GetProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Profile fetched successfully",
-		"data":    user,
+		"data":    ownProfile{User: user, Email: user.Email, TwoFactorEnabled: user.TOTPEnabled},
 	})
 }
+
+// ownProfile adds the fields of User that are hidden everywhere else, since they
+// only concern the user themselves.
+type ownProfile struct {
+	models.User
+	Email            string `json:"email"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	_ "embed"
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/utils"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"deref": func(f *float64) float64 { return *f },
+}).Parse(reportHTML))
+
+type FoodCount struct {
+	FoodName string `gorm:"column:food_name" json:"food_name"`
+	Times    int    `gorm:"column:times" json:"times"`
+	Calories int    `gorm:"column:calories" json:"calories"`
+}
+
+type ReportComment struct {
+	Date         time.Time `gorm:"column:di_date" json:"date"`
+	Nutritionist string    `gorm:"column:nutritionist" json:"nutritionist"`
+	Meal         string    `gorm:"column:meal" json:"meal,omitempty"` // food name when the comment is about one meal
+	Content      string    `gorm:"column:content" json:"content"`
+}
+
+type ProgressReport struct {
+	Period        string                `json:"period"`
+	From          string                `json:"from"`
+	To            string                `json:"to"`
+	UserID        string                `json:"user_id"`
+	Username      string                `json:"username"`
+	BMR           float64               `json:"bmr"`
+	Aggregates    IntakeRangeAggregates `json:"aggregates"`
+	Adherence     float64               `json:"adherence"`      // % of logged days within target
+	PlanAdherence *float64              `json:"plan_adherence"` // average meal plan adherence, if a plan covered the period
+	AverageVsBMR  float64               `json:"average_vs_bmr"`
+	StartWeight   *float64              `json:"start_weight"`
+	EndWeight     *float64              `json:"end_weight"`
+	WeightChange  *float64              `json:"weight_change"`
+	TopFoods      []FoodCount           `json:"top_foods"`
+	Comments      []ReportComment       `json:"comments"`
+	Days          []IntakeDaySummary    `json:"days"`
+}
+
+// reportPeriod returns the calendar week (Monday to Sunday) or month containing anchor.
+func reportPeriod(period string, anchor time.Time) (time.Time, time.Time, bool) {
+	switch period {
+	case "weekly":
+		from := anchor.AddDate(0, 0, -((int(anchor.Weekday()) + 6) % 7))
+		return from, from.AddDate(0, 0, 6), true
+	case "monthly":
+		from := time.Date(anchor.Year(), anchor.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, -1), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// weightAt returns the last weight recorded before the given instant.
+func weightAt(userID string, before time.Time) *float64 {
+	var log models.WeightLog
+	err := config.DB.
+		Where("U_ID = ? AND WL_RecordedAt < ?", userID, before).
+		Order("WL_RecordedAt DESC").
+		First(&log).Error
+	if err != nil {
+		return nil
+	}
+	return &log.WLWeight
+}
+
+// buildReport gathers everything a progress report shows for one user and period.
+func buildReport(user models.User, period string, from time.Time, to time.Time) (ProgressReport, error) {
+	report := ProgressReport{
+		Period:   period,
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		UserID:   user.UID,
+		Username: user.Username,
+		BMR:      user.BMR,
+	}
+
+	days, agg, err := intakeHistory(user.UID, from, to, user.BMR)
+	if err != nil {
+		return report, err
+	}
+	report.Days = days
+	report.Aggregates = agg
+	if agg.DaysLogged > 0 {
+		within := agg.DaysLogged - agg.DaysOverTarget - agg.DaysUnderTarget
+		report.Adherence = float64(within) / float64(agg.DaysLogged) * 100
+		report.AverageVsBMR = agg.AverageCalories - user.BMR
+	}
+
+	planned := plannedCaloriesByDay([]string{user.UID})
+	var planTotal float64
+	planDays := 0
+	for _, d := range days {
+		if score := adherence(d.TotalCalories, planned[user.UID+"|"+d.Date.Format("2006-01-02")]); score != nil {
+			planTotal += *score
+			planDays++
+		}
+	}
+	if planDays > 0 {
+		avg := planTotal / float64(planDays)
+		report.PlanAdherence = &avg
+	}
+
+	loc := utils.UserLocation(user.TimeZone)
+	periodStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	periodEnd := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	report.StartWeight = weightAt(user.UID, periodStart)
+	report.EndWeight = weightAt(user.UID, periodEnd)
+	if report.StartWeight == nil {
+		// No weight before the period: start from the first one logged during it.
+		var first models.WeightLog
+		if config.DB.Where("U_ID = ? AND WL_RecordedAt >= ?", user.UID, periodStart).
+			Order("WL_RecordedAt ASC").First(&first).Error == nil && first.WLRecordedAt.Before(periodEnd) {
+			report.StartWeight = &first.WLWeight
+		}
+	}
+	if report.StartWeight != nil && report.EndWeight != nil {
+		change := *report.EndWeight - *report.StartWeight
+		report.WeightChange = &change
+	}
+
+	if err := config.DB.Model(&models.Meal{}).
+		Select("MIN(meals.M_FoodName) AS food_name, COUNT(*) AS times, SUM(meals.M_Calories) AS calories").
+		Joins("JOIN daily_intakes ON daily_intakes.DI_ID = meals.Daily_Intakes_DI_ID").
+		Where("daily_intakes.CustomerUsers_U_ID = ? AND daily_intakes.DI_Date BETWEEN ? AND ?", user.UID, report.From, report.To).
+		Group("LOWER(meals.M_FoodName)").
+		Order("times DESC").
+		Limit(5).
+		Scan(&report.TopFoods).Error; err != nil {
+		return report, err
+	}
+
+	if err := config.DB.Model(&models.Comment{}).
+		Select("daily_intakes.DI_Date AS di_date, users.U_Username AS nutritionist, COALESCE(meals.M_FoodName, '') AS meal, comments.C_Content AS content").
+		Joins("JOIN daily_intakes ON daily_intakes.DI_ID = comments.Daily_Intakes_DI_ID").
+		Joins("LEFT JOIN users ON users.U_ID = comments.NutritionistUsers_U_ID").
+		Joins("LEFT JOIN meals ON meals.M_ID = comments.Meals_M_ID").
+		Where("daily_intakes.CustomerUsers_U_ID = ? AND daily_intakes.DI_Date BETWEEN ? AND ?", user.UID, report.From, report.To).
+		Where("comments.C_AuthorRole = ?", "Nutritionist").
+		Order("daily_intakes.DI_Date").
+		Scan(&report.Comments).Error; err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// GET /reports/:period?date=YYYY-MM-DD[&user_id=][&format=html]
+func GetReport(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	role, _ := c.Get("role")
+	subjectID := userID
+	if client := c.Query("user_id"); client != "" && client != userID {
+		if role != "Nutritionist" || !isAssignedNutritionist(userID, client) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Client is not assigned to you"})
+			return
+		}
+		subjectID = client
+	}
+
+	var user models.User
+	if err := config.DB.Where("U_ID = ?", subjectID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	dateStr := c.Query("date")
+	if dateStr == "" {
+		dateStr = utils.LocalDate(time.Now(), utils.UserLocation(user.TimeZone))
+	}
+	anchor, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format"})
+		return
+	}
+
+	period := c.Param("period")
+	from, to, ok := reportPeriod(period, anchor)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be weekly or monthly"})
+		return
+	}
+
+	report, err := buildReport(user, period, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	if c.Query("format") == "html" {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		if err := reportTemplate.Execute(c.Writer, report); err != nil {
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
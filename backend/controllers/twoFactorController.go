@@ -0,0 +1,433 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Purposes of the challenge tokens handed out between the password and the
+// second step of a login.
+const (
+	challengeTwoFactor = "2fa"       // the user has 2FA and must give a code
+	challengeSetup     = "2fa_setup" // the user must enroll before logging in
+)
+
+const (
+	totpIssuer        = "CaloriSync"
+	recoveryCodeCount = 10
+)
+
+// twoFactorEnforced is true when the user may not log in or stay without 2FA.
+func twoFactorEnforced(user models.User) bool {
+	return config.TwoFactorRequired(user.Role)
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return hashResetToken(code)
+}
+
+// newRecoveryCodes replaces the user's recovery codes with a fresh set and
+// returns them in the clear; this is the only time they can be shown.
+func newRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("U_ID = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(raw)
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = models.RecoveryCode{UserID: userID, RCCodeHash: hashRecoveryCode(code)}
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useTOTP checks a code from the authenticator app. The matching time step is
+// stored so the same code cannot be replayed, even by a concurrent request.
+func useTOTP(user *models.User, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+	step, ok := utils.VerifyTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false
+	}
+
+	claimed := config.DB.Model(&models.User{}).
+		Where("U_ID = ? AND U_TOTPLastStep < ?", user.UID, step).
+		Update("U_TOTPLastStep", step)
+	if claimed.Error != nil || claimed.RowsAffected == 0 {
+		return false
+	}
+	user.TOTPLastStep = step
+	return true
+}
+
+// useRecoveryCode spends one of the user's recovery codes.
+func useRecoveryCode(user models.User, code string) bool {
+	if strings.TrimSpace(code) == "" {
+		return false
+	}
+	claimed := config.DB.Model(&models.RecoveryCode{}).
+		Where("U_ID = ? AND RC_CodeHash = ? AND RC_UsedAt IS NULL", user.UID, hashRecoveryCode(code)).
+		Update("RC_UsedAt", time.Now())
+	return claimed.Error == nil && claimed.RowsAffected == 1
+}
+
+// secondFactor accepts either a TOTP code or, failing that, a recovery code.
+func secondFactor(user *models.User, code string, recoveryCode string) bool {
+	if code != "" {
+		return useTOTP(user, code)
+	}
+	return useRecoveryCode(*user, recoveryCode)
+}
+
+// issueLogin answers a finished login with the session token.
+func issueLogin(c *gin.Context, user models.User, extra gin.H) {
+	token, err := utils.GenerateToken(user.UID, user.Role, user.SessionVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	response := gin.H{
+		"message": "Login successful",
+		"token":   token,
+		"role":    user.Role,
+		"user_id": user.UID,
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// challengeUser loads the user a challenge token was issued to. Tokens die with a
+// password change or deactivation, like sessions do.
+func challengeUser(c *gin.Context, token string, purpose string) (models.User, bool) {
+	var user models.User
+
+	userID, sv, err := utils.ParseChallengeToken(token, purpose)
+	if err == nil {
+		err = config.DB.Where("U_ID = ?", userID).First(&user).Error
+	}
+	if err != nil || user.SessionVersion != sv || user.DeactivatedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge is invalid or has expired, log in again"})
+		return user, false
+	}
+
+	c.Set("user_id", user.UID)
+	c.Set("role", user.Role)
+	return user, true
+}
+
+// startEnrollment stores a new secret for a user without 2FA and returns what the
+// authenticator app needs. Enrolling again before confirming replaces the secret.
+func startEnrollment(c *gin.Context, user models.User) {
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.NewTOTPSecret()
+	if err == nil {
+		err = config.DB.Model(&user).Update("U_TOTPSecret", secret).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPURI(totpIssuer, user.Username, secret),
+	})
+}
+
+// finishEnrollment turns 2FA on once the user proves their app produces valid
+// codes. On failure it has already answered the request.
+func finishEnrollment(c *gin.Context, user *models.User, code string) ([]string, bool) {
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return nil, false
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return nil, false
+	}
+	if !useTOTP(user, code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return nil, false
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		enabled := tx.Model(&models.User{}).
+			Where("U_ID = ? AND U_TOTPEnabled = ?", user.UID, false).
+			Update("U_TOTPEnabled", true)
+		if enabled.Error != nil {
+			return enabled.Error
+		}
+		if enabled.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var err error
+		codes, err = newRecoveryCodes(tx, user.UID)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return nil, false
+	}
+
+	user.TOTPEnabled = true
+	recordAudit(c, "enable_2fa", "user", user.UID, user.UID, nil, nil)
+	return codes, true
+}
+
+func currentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if err := config.DB.Where("U_ID = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// POST /2fa/setup
+// Starts enrollment: returns a new secret and its otpauth:// URI for a QR code.
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	startEnrollment(c, user)
+}
+
+// POST /2fa/enable
+// Confirms enrollment with a code from the app and returns the recovery codes.
+func EnableTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, ok := finishEnrollment(c, &user, input.Code)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		"recovery_codes": codes,
+	})
+}
+
+// POST /2fa/disable
+// Turns 2FA off. Needs the password and a current code or a recovery code, and is
+// refused while 2FA is enforced for the user's role.
+func DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if twoFactorEnforced(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for nutritionists"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+		return
+	}
+	if !secondFactor(&user, input.Code, input.RecoveryCode) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"U_TOTPEnabled":  false,
+			"U_TOTPSecret":   "",
+			"U_TOTPLastStep": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("U_ID = ?", user.UID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	recordAudit(c, "disable_2fa", "user", user.UID, user.UID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// POST /2fa/recovery-codes
+// Replaces all recovery codes, e.g. after some were used up. Needs a current code.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !useTOTP(&user, input.Code) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := newRecoveryCodes(config.DB, user.UID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+
+	recordAudit(c, "regenerate_recovery_codes", "user", user.UID, user.UID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// POST /login/2fa
+// Second step of the login: trades the challenge token and a TOTP or recovery
+// code for a session token. Wrong codes count as failed logins.
+func LoginTwoFactor(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "challenge_token and code or recovery_code required"})
+		return
+	}
+
+	user, ok := challengeUser(c, input.ChallengeToken, challengeTwoFactor)
+	if !ok {
+		return
+	}
+	reserved, ok := reserveAttempt(c, loginKeys(c, user.Username))
+	if !ok {
+		return
+	}
+
+	if !secondFactor(&user, input.Code, input.RecoveryCode) {
+		reserved.failed(user.UID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	reserved.succeeded()
+
+	extra := gin.H{}
+	if input.Code == "" {
+		var left int64
+		config.DB.Model(&models.RecoveryCode{}).Where("U_ID = ? AND RC_UsedAt IS NULL", user.UID).Count(&left)
+		extra["recovery_codes_left"] = left
+		recordAudit(c, "recovery_code_login", "user", user.UID, user.UID, nil, gin.H{"left": left})
+	}
+	issueLogin(c, user, extra)
+}
+
+// POST /login/2fa/setup
+// Starts enrollment for a user whose login is blocked until they have 2FA.
+func LoginTwoFactorSetup(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := challengeUser(c, input.ChallengeToken, challengeSetup)
+	if !ok {
+		return
+	}
+	startEnrollment(c, user)
+}
+
+// POST /login/2fa/enable
+// Finishes enrollment during login and logs the user in, returning the recovery
+// codes alongside the session token.
+func LoginTwoFactorEnable(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := challengeUser(c, input.ChallengeToken, challengeSetup)
+	if !ok {
+		return
+	}
+
+	codes, ok := finishEnrollment(c, &user, input.Code)
+	if !ok {
+		return
+	}
+	issueLogin(c, user, gin.H{"recovery_codes": codes})
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"errors"
+	"fp-pbkk/config"
+	"fp-pbkk/events"
+	"fp-pbkk/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// intakeWritable reports whether meals on the day may change: either it was never
+// locked, or a nutritionist approved an unlock whose window is still open.
+func intakeWritable(intake models.DailyIntake) bool {
+	if !intake.DIIsLocked {
+		return true
+	}
+
+	var count int64
+	config.DB.Model(&models.UnlockRequest{}).
+		Where("Daily_Intakes_DI_ID = ? AND UR_Status = ? AND UR_UnlockUntil > ?", intake.DIID, models.UnlockApproved, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+func transitionUnlock(tx *gorm.DB, req *models.UnlockRequest, to string, actorID string) error {
+	from := req.URStatus
+	req.URStatus = to
+	return tx.Create(&models.UnlockTransition{
+		UnlockRequestID: req.URID,
+		UTFromStatus:    from,
+		UTToStatus:      to,
+		ActorID:         actorID,
+	}).Error
+}
+
+// REQUEST UNLOCK
+func RequestUnlock(c *gin.Context) {
+	userID := c.GetString("user_id")
+	diID := c.Param("di_id")
+
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var intake models.DailyIntake
+	err := config.DB.Where("DI_ID = ? AND CustomerUsers_U_ID = ?", diID, userID).First(&intake).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "intake not found"})
+		return
+	}
+
+	if !intake.DIIsLocked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "intake is not locked"})
+		return
+	}
+
+	var assigned int64
+	config.DB.Model(&models.ClientAssignment{}).Scopes(models.AcceptedAssignments).Where("CustomerUsers_U_ID = ?", userID).Count(&assigned)
+	if assigned == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no nutritionist assigned to review the request"})
+		return
+	}
+
+	var open int64
+	config.DB.Model(&models.UnlockRequest{}).
+		Where("Daily_Intakes_DI_ID = ? AND UR_Status = ?", diID, models.UnlockPending).
+		Count(&open)
+	if open > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "an unlock request is already pending"})
+		return
+	}
+
+	req := models.UnlockRequest{
+		URID:           uuid.New().String(),
+		DailyIntakeID:  diID,
+		CustomerUserID: userID,
+		URReason:       input.Reason,
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := transitionUnlock(tx, &req, models.UnlockPending, userID); err != nil {
+			return err
+		}
+		return tx.Create(&req).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create unlock request"})
+		return
+	}
+
+	recordAudit(c, "request_unlock", "unlock_request", req.URID, userID, nil, req)
+	events.Publish(events.UnlockRequested, req, dayParticipants(userID, userID)...)
+
+	c.JSON(http.StatusCreated, req)
+}
+
+// GET UNLOCK REQUESTS OF A DAY
+func GetUnlockRequests(c *gin.Context) {
+	userID := c.GetString("user_id")
+	diID := c.Param("di_id")
+
+	var requests []models.UnlockRequest
+	if err := config.DB.
+		Preload("Transitions").
+		Where("Daily_Intakes_DI_ID = ? AND CustomerUsers_U_ID = ?", diID, userID).
+		Order("UR_CreatedAt DESC").
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": requests})
+}
+
+func GetNutritionistUnlockRequests(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	status := c.DefaultQuery("status", models.UnlockPending)
+
+	var requests []models.UnlockRequest
+	if err := config.DB.
+		Preload("CustomerUser").
+		Preload("Transitions").
+		Joins("JOIN client_assignments ON client_assignments.CustomerUsers_U_ID = unlock_requests.CustomerUsers_U_ID").
+		Where("client_assignments.NutritionistUsers_U_ID = ? AND client_assignments.CA_AcceptedAt IS NOT NULL", c.GetString("user_id")).
+		Where("unlock_requests.UR_Status = ?", status).
+		Order("unlock_requests.UR_CreatedAt ASC").
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unlock requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": requests})
+}
+
+func ReviewUnlockRequest(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != "Nutritionist" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	nutritionistID := c.GetString("user_id")
+
+	var input struct {
+		Decision string `json:"decision" binding:"required"` // "approve" or "reject"
+		Note     string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
+		return
+	}
+
+	var to string
+	switch input.Decision {
+	case "approve":
+		to = models.UnlockApproved
+	case "reject":
+		to = models.UnlockRejected
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be approve or reject"})
+		return
+	}
+
+	var req models.UnlockRequest
+	if err := config.DB.Where("UR_ID = ?", c.Param("ur_id")).First(&req).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unlock request not found"})
+		return
+	}
+
+	if !isAssignedNutritionist(nutritionistID, req.CustomerUserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Client is not assigned to you"})
+		return
+	}
+
+	if req.URStatus != models.UnlockPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Unlock request already " + req.URStatus})
+		return
+	}
+
+	now := time.Now()
+	req.NutritionistID = nutritionistID
+	req.URReviewNote = input.Note
+	req.URReviewedAt = &now
+	if to == models.UnlockApproved {
+		until := now.Add(time.Duration(config.EnvInt("UNLOCK_WINDOW_MINUTES", 60)) * time.Minute)
+		req.URUnlockUntil = &until
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := transitionUnlock(tx, &req, to, nutritionistID); err != nil {
+			return err
+		}
+		// Only move the request if nobody reviewed it in the meantime.
+		result := tx.Model(&models.UnlockRequest{}).
+			Where("UR_ID = ? AND UR_Status = ?", req.URID, models.UnlockPending).
+			Updates(map[string]interface{}{
+				"UR_Status":              req.URStatus,
+				"NutritionistUsers_U_ID": req.NutritionistID,
+				"UR_ReviewNote":          req.URReviewNote,
+				"UR_ReviewedAt":          req.URReviewedAt,
+				"UR_UnlockUntil":         req.URUnlockUntil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Unlock request was already reviewed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review unlock request"})
+		return
+	}
+
+	recordAudit(c, input.Decision+"_unlock", "unlock_request", req.URID, req.CustomerUserID, nil, req)
+	events.Publish(events.UnlockReviewed, req, dayParticipants(req.CustomerUserID, nutritionistID)...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unlock request " + req.URStatus, "data": req})
+}
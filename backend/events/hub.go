@@ -0,0 +1,76 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types pushed to clients.
+const (
+	CommentCreated      = "comment.created"
+	IntakeLocked        = "intake.locked"
+	UnlockRequested     = "unlock.requested"
+	UnlockReviewed      = "unlock.reviewed"
+	AssignmentRequested = "assignment.requested"
+	AssignmentAdded     = "assignment.added"
+	AssignmentRemoved   = "assignment.removed"
+	MessageNew          = "message.new"
+	MessageDelivered    = "message.delivered"
+	MessageRead         = "message.read"
+	MessageTyping       = "message.typing"
+	NotificationNew     = "notification.new"
+)
+
+const subscriberBacklog = 32
+
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+	At   time.Time   `json:"at"`
+}
+
+// The hub is in-process: every open stream of a user gets a copy of the events
+// published to that user. Streams on other server instances are not reached.
+var (
+	mu          sync.RWMutex
+	subscribers = map[string]map[chan Event]struct{}{}
+)
+
+// Subscribe opens a stream for the user. The returned function must be called
+// when the stream ends.
+func Subscribe(userID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBacklog)
+
+	mu.Lock()
+	if subscribers[userID] == nil {
+		subscribers[userID] = map[chan Event]struct{}{}
+	}
+	subscribers[userID][ch] = struct{}{}
+	mu.Unlock()
+
+	return ch, func() {
+		mu.Lock()
+		delete(subscribers[userID], ch)
+		if len(subscribers[userID]) == 0 {
+			delete(subscribers, userID)
+		}
+		mu.Unlock()
+	}
+}
+
+// Publish sends an event to every open stream of the given users. It never blocks:
+// a stream that has fallen a full backlog behind misses the event.
+func Publish(eventType string, data interface{}, userIDs ...string) {
+	ev := Event{Type: eventType, Data: data, At: time.Now()}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, id := range userIDs {
+		for ch := range subscribers[id] {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
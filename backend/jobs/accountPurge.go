@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const AccountPurgeJob = "account_purge"
+
+// StartAccountPurge erases accounts whose cooling-off period is over, once at
+// startup and then every ACCOUNT_PURGE_INTERVAL_MINUTES.
+func StartAccountPurge() {
+	interval := time.Duration(config.EnvInt("ACCOUNT_PURGE_INTERVAL_MINUTES", 60)) * time.Minute
+
+	go func() {
+		runAccountPurge()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runAccountPurge()
+		}
+	}()
+}
+
+func runAccountPurge() {
+	var userIDs []string
+	if err := config.DB.Model(&models.User{}).
+		Where("U_DeactivatedAt IS NOT NULL AND U_PurgeAfter <= ?", time.Now()).
+		Pluck("U_ID", &userIDs).Error; err != nil {
+		recordRun(AccountPurgeJob, 0, err)
+		return
+	}
+
+	var purged int64
+	for _, id := range userIDs {
+		if err := config.DB.Transaction(func(tx *gorm.DB) error {
+			return purgeUser(tx, id)
+		}); err != nil {
+			log.Printf("account purge: user %s: %v", id, err)
+			recordRun(AccountPurgeJob, purged, err)
+			return
+		}
+		purged++
+	}
+
+	recordRun(AccountPurgeJob, purged, nil)
+}
+
+// purgeUser hard-deletes everything the user owns as a client, including comments
+// nutritionists wrote on their days, and anonymizes what they wrote as a nutritionist
+// on other people's data.
+func purgeUser(tx *gorm.DB, userID string) error {
+	days := tx.Model(&models.DailyIntake{}).Select("DI_ID").Where("CustomerUsers_U_ID = ?", userID)
+	plans := tx.Model(&models.MealPlan{}).Select("MP_ID").Where("CustomerUsers_U_ID = ?", userID)
+	unlocks := tx.Model(&models.UnlockRequest{}).Select("UR_ID").Where("CustomerUsers_U_ID = ?", userID)
+	meals := tx.Unscoped().Model(&models.Meal{}).Select("M_ID").Where("Daily_Intakes_DI_ID IN (?) OR U_ID = ?", days, userID)
+
+	var user models.User
+	if err := tx.Select("U_Username").Where("U_ID = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+
+	// Owned as a client
+	if err := tx.Unscoped().Where("Daily_Intakes_DI_ID IN (?)", days).Delete(&models.Comment{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("Daily_Intakes_DI_ID IN (?) OR U_ID = ?", days, userID).Delete(&models.CommentRead{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("Meals_M_ID IN (?)", meals).Delete(&models.MealVersion{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("Daily_Intakes_DI_ID IN (?) OR U_ID = ?", days, userID).Delete(&models.Meal{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("Unlock_Requests_UR_ID IN (?)", unlocks).Delete(&models.UnlockTransition{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("CustomerUsers_U_ID = ?", userID).Delete(&models.UnlockRequest{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("Meal_Plans_MP_ID IN (?)", plans).Delete(&models.PlannedMeal{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("CustomerUsers_U_ID = ?", userID).Delete(&models.MealPlan{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("CustomerUsers_U_ID = ? OR NutritionistUsers_U_ID = ?", userID, userID).Delete(&models.ClientAssignment{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("U_ID = ?", userID).Delete(&models.WeightLog{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("DM_SenderID = ? OR DM_RecipientID = ?", userID, userID).Delete(&models.DirectMessage{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("U_ID = ?", userID).Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("U_ID = ?", userID).Delete(&models.PasswordReset{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("U_ID = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("LT_Key IN ?", []string{"user:" + strings.ToLower(user.Username), "reset:user:" + userID}).Delete(&models.LoginThrottle{}).Error; err != nil {
+		return err
+	}
+	// Outbox rows from before they carried the user are matched by address, as
+	// long as no other account uses it.
+	ownAddress := tx.Model(&models.User{}).Select("U_Email").
+		Where("U_ID = ? AND U_Email <> ''", userID).
+		Where("NOT EXISTS (SELECT 1 FROM users other WHERE other.U_Email = users.U_Email AND other.U_ID <> users.U_ID)")
+	if err := tx.Where("U_ID = ? OR (U_ID IS NULL AND EJ_To IN (?))", userID, ownAddress).Delete(&models.EmailJob{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("CustomerUsers_U_ID = ?", userID).Delete(&models.DailyIntake{}).Error; err != nil {
+		return err
+	}
+
+	// Written as a nutritionist on other clients' data
+	if err := tx.Unscoped().Model(&models.Comment{}).Where("NutritionistUsers_U_ID = ?", userID).Update("NutritionistUsers_U_ID", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(&models.Comment{}).Where("C_AuthorID = ?", userID).Update("C_AuthorID", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.MealPlan{}).Where("NutritionistUsers_U_ID = ?", userID).Update("NutritionistUsers_U_ID", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.UnlockRequest{}).Where("NutritionistUsers_U_ID = ?", userID).Update("NutritionistUsers_U_ID", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.UnlockTransition{}).Where("UT_ActorID = ?", userID).Update("UT_ActorID", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.MealVersion{}).Where("MV_EditedBy = ?", userID).Update("MV_EditedBy", "").Error; err != nil {
+		return err
+	}
+
+	// The audit log keeps that something happened to the account, but not the data.
+	// Lockout entries are keyed by username, so that goes too.
+	audit := tx.Session(&gorm.Session{SkipHooks: true})
+	if err := audit.Model(&models.AuditLog{}).Where("AL_SubjectID = ?", userID).Updates(map[string]interface{}{
+		"AL_Before": "",
+		"AL_After":  "",
+	}).Error; err != nil {
+		return err
+	}
+	if err := audit.Model(&models.AuditLog{}).Where("AL_SubjectID = ? AND AL_EntityType = ?", userID, "login").Update("AL_EntityID", "").Error; err != nil {
+		return err
+	}
+
+	return tx.Where("U_ID = ?", userID).Delete(&models.User{}).Error
+}
@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/events"
+	"fp-pbkk/models"
+	"fp-pbkk/notify"
+	"fp-pbkk/utils"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const AutoLockJob = "auto_lock"
+
+// StartAutoLock locks every unlocked day once the grace period past the owner's
+// local midnight is over. It runs once at startup, so days missed while the server
+// was down are caught up, and then every AUTO_LOCK_INTERVAL_MINUTES.
+func StartAutoLock() {
+	interval := time.Duration(config.EnvInt("AUTO_LOCK_INTERVAL_MINUTES", 15)) * time.Minute
+
+	go func() {
+		runAutoLock()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runAutoLock()
+		}
+	}()
+}
+
+func runAutoLock() {
+	grace := time.Duration(config.EnvInt("AUTO_LOCK_GRACE_HOURS", 2)) * time.Hour
+	now := time.Now()
+
+	var zones []string
+	if err := config.DB.Model(&models.User{}).Distinct().Pluck("U_TimeZone", &zones).Error; err != nil {
+		recordRun(AutoLockJob, 0, err)
+		return
+	}
+
+	var locked int64
+	for _, zone := range zones {
+		// A day may be locked once its local midnight plus the grace period has passed.
+		lastLockable := utils.LocalDate(now.Add(-grace).AddDate(0, 0, -1), utils.UserLocation(zone))
+
+		var days []models.DailyIntake
+		if err := config.DB.Select("DI_ID", "DI_Date", "CustomerUsers_U_ID").
+			Where("DI_isLocked = ? AND DI_Date <= ?", false, lastLockable).
+			Where("CustomerUsers_U_ID IN (?)", config.DB.Model(&models.User{}).Select("U_ID").Where("U_TimeZone = ?", zone)).
+			Find(&days).Error; err != nil {
+			recordRun(AutoLockJob, locked, err)
+			return
+		}
+
+		// Each day is locked on its own so that only the days this run locked are
+		// announced, not those locked by someone else in the meantime.
+		var lockedDays []models.DailyIntake
+		for _, d := range days {
+			result := config.DB.Model(&models.DailyIntake{}).
+				Where("DI_ID = ? AND DI_isLocked = ?", d.DIID, false).
+				Updates(map[string]interface{}{
+					"DI_isLocked": true,
+					"DI_Version":  gorm.Expr("DI_Version + 1"),
+				})
+			if result.Error != nil {
+				publishLocked(lockedDays)
+				recordRun(AutoLockJob, locked+int64(len(lockedDays)), result.Error)
+				return
+			}
+			if result.RowsAffected > 0 {
+				lockedDays = append(lockedDays, d)
+			}
+		}
+		locked += int64(len(lockedDays))
+
+		publishLocked(lockedDays)
+	}
+
+	recordRun(AutoLockJob, locked, nil)
+}
+
+// publishLocked tells each owner and their nutritionists which days were locked,
+// and leaves a notification in the owner's inbox.
+func publishLocked(days []models.DailyIntake) {
+	if len(days) == 0 {
+		return
+	}
+
+	owners := make([]string, len(days))
+	for i, d := range days {
+		owners[i] = d.CustomerUserID
+	}
+
+	var assignments []models.ClientAssignment
+	config.DB.Scopes(models.AcceptedAssignments).Where("CustomerUsers_U_ID IN ?", owners).Find(&assignments)
+	nutritionists := map[string][]string{}
+	for _, a := range assignments {
+		nutritionists[a.CustomerUserID] = append(nutritionists[a.CustomerUserID], a.NutritionistID)
+	}
+
+	notifications := make([]models.Notification, len(days))
+	for i, d := range days {
+		events.Publish(events.IntakeLocked,
+			map[string]interface{}{"di_id": d.DIID, "date": d.DIDate, "user_id": d.CustomerUserID, "auto": true},
+			append([]string{d.CustomerUserID}, nutritionists[d.CustomerUserID]...)...)
+
+		notifications[i] = models.Notification{
+			UserID: d.CustomerUserID,
+			NType:  notify.DayLocked,
+			NTitle: "Your log for " + d.DIDate.Format("2 Jan 2006") + " was locked",
+			NBody:  "Ask your nutritionist to unlock it if something is missing.",
+			NLink:  "/dashboard-user/intakeLogs",
+			NKey:   notify.Key(notify.DayLocked, d.DIID),
+		}
+	}
+	notify.Send(notifications...)
+}
+
+// recordRun stores the outcome of a job run so it can be inspected through the API.
+func recordRun(name string, affected int64, err error) {
+	run := models.JobRun{
+		JRName:      name,
+		JRLastRunAt: time.Now(),
+		JRStatus:    "ok",
+		JRAffected:  affected,
+	}
+	if err != nil {
+		run.JRStatus = "failed"
+		run.JRError = err.Error()
+		log.Printf("job %s failed: %v", name, err)
+	}
+
+	if err := config.DB.Save(&run).Error; err != nil {
+		log.Printf("job %s: could not record run: %v", name, err)
+	}
+}
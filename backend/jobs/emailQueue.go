@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/mailer"
+	"time"
+)
+
+const EmailQueueJob = "email_queue"
+
+// StartEmailQueue sends queued emails every MAIL_QUEUE_INTERVAL_SECONDS.
+func StartEmailQueue() {
+	interval := time.Duration(config.EnvInt("MAIL_QUEUE_INTERVAL_SECONDS", 30)) * time.Second
+	sender := mailer.FromEnv()
+
+	go func() {
+		runEmailQueue(sender)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runEmailQueue(sender)
+		}
+	}()
+}
+
+func runEmailQueue(sender mailer.Sender) {
+	sent, err := mailer.SendDue(sender, 100)
+	recordRun(EmailQueueJob, sent, err)
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"time"
+)
+
+const LoginThrottlePurgeJob = "login_throttle_purge"
+
+// StartLoginThrottlePurge deletes login and password reset throttle counters that
+// have run out, once at startup and then every LOGIN_THROTTLE_PURGE_INTERVAL_MINUTES.
+func StartLoginThrottlePurge() {
+	interval := time.Duration(config.EnvInt("LOGIN_THROTTLE_PURGE_INTERVAL_MINUTES", 60)) * time.Minute
+
+	go func() {
+		runLoginThrottlePurge()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runLoginThrottlePurge()
+		}
+	}()
+}
+
+// A counter whose failures are out of the window and that is not locked out would
+// be started over on the next attempt anyway. IP counters are never cleared by a
+// successful login, so without this they would pile up.
+func runLoginThrottlePurge() {
+	now := time.Now()
+	window := time.Duration(config.EnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute
+
+	result := config.DB.
+		Where("LT_LastFailureAt < ? AND (LT_LockedUntil IS NULL OR LT_LockedUntil <= ?)", now.Add(-window), now).
+		Delete(&models.LoginThrottle{})
+	recordRun(LoginThrottlePurgeJob, result.RowsAffected, result.Error)
+}
@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"fp-pbkk/notify"
+	"fp-pbkk/utils"
+	"time"
+)
+
+const MissingLogReminderJob = "missing_log_reminder"
+
+// StartMissingLogReminder reminds clients who have not logged a meal today, once
+// it is past REMINDER_HOUR (default 20:00) in their time zone. It checks every
+// REMINDER_INTERVAL_MINUTES; each client gets at most one reminder per day.
+func StartMissingLogReminder() {
+	interval := time.Duration(config.EnvInt("REMINDER_INTERVAL_MINUTES", 30)) * time.Minute
+
+	go func() {
+		runMissingLogReminder()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runMissingLogReminder()
+		}
+	}()
+}
+
+func runMissingLogReminder() {
+	hour := config.EnvInt("REMINDER_HOUR", 20)
+	now := time.Now()
+
+	var zones []string
+	if err := config.DB.Model(&models.User{}).Distinct().Pluck("U_TimeZone", &zones).Error; err != nil {
+		recordRun(MissingLogReminderJob, 0, err)
+		return
+	}
+
+	var reminded int64
+	for _, zone := range zones {
+		local := now.In(utils.UserLocation(zone))
+		if local.Hour() < hour {
+			continue
+		}
+		today := local.Format("2006-01-02")
+
+		var userIDs []string
+		if err := config.DB.Model(&models.User{}).
+			Where("U_TimeZone = ? AND U_Role = ? AND U_DeactivatedAt IS NULL", zone, "User").
+			Where(`NOT EXISTS (SELECT 1 FROM daily_intakes
+				JOIN meals ON meals.Daily_Intakes_DI_ID = daily_intakes.DI_ID AND meals.M_DeletedAt IS NULL
+				WHERE daily_intakes.CustomerUsers_U_ID = users.U_ID AND daily_intakes.DI_Date = ?)`, today).
+			Pluck("U_ID", &userIDs).Error; err != nil {
+			recordRun(MissingLogReminderJob, reminded, err)
+			return
+		}
+
+		notifications := make([]models.Notification, len(userIDs))
+		for i, id := range userIDs {
+			notifications[i] = models.Notification{
+				UserID: id,
+				NType:  notify.MissingLog,
+				NTitle: "Nothing logged today",
+				NBody:  "Take a minute to add today's meals before the day is locked.",
+				NLink:  "/dashboard-user/intakeLogs",
+				NKey:   notify.Key(notify.MissingLog, today),
+			}
+		}
+		reminded += int64(notify.Send(notifications...))
+	}
+
+	recordRun(MissingLogReminderJob, reminded, nil)
+}
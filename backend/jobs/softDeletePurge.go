@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"time"
+)
+
+const SoftDeletePurgeJob = "soft_delete_purge"
+
+// StartSoftDeletePurge permanently removes meals (with their edit history) and
+// comments that were deleted longer than SOFT_DELETE_RETENTION_DAYS ago, once at
+// startup and then every SOFT_DELETE_PURGE_INTERVAL_MINUTES.
+func StartSoftDeletePurge() {
+	interval := time.Duration(config.EnvInt("SOFT_DELETE_PURGE_INTERVAL_MINUTES", 60)) * time.Minute
+
+	go func() {
+		runSoftDeletePurge()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runSoftDeletePurge()
+		}
+	}()
+}
+
+func runSoftDeletePurge() {
+	retention := time.Duration(config.EnvInt("SOFT_DELETE_RETENTION_DAYS", 30)) * 24 * time.Hour
+	cutoff := time.Now().Add(-retention)
+
+	// Comments anchored to a meal and its edit history go with it.
+	expired := config.DB.Unscoped().Model(&models.Meal{}).Select("M_ID").Where("M_DeletedAt < ?", cutoff)
+	if err := config.DB.Unscoped().Where("Meals_M_ID IN (?)", expired).Delete(&models.Comment{}).Error; err != nil {
+		recordRun(SoftDeletePurgeJob, 0, err)
+		return
+	}
+	if err := config.DB.Where("Meals_M_ID IN (?)", expired).Delete(&models.MealVersion{}).Error; err != nil {
+		recordRun(SoftDeletePurgeJob, 0, err)
+		return
+	}
+
+	meals := config.DB.Unscoped().Where("M_DeletedAt < ?", cutoff).Delete(&models.Meal{})
+	if meals.Error != nil {
+		recordRun(SoftDeletePurgeJob, 0, meals.Error)
+		return
+	}
+
+	comments := config.DB.Unscoped().Where("C_DeletedAt < ?", cutoff).Delete(&models.Comment{})
+	recordRun(SoftDeletePurgeJob, meals.RowsAffected+comments.RowsAffected, comments.Error)
+}
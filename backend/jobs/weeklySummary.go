@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/mailer"
+	"fp-pbkk/models"
+	"fp-pbkk/utils"
+	"log"
+	"time"
+)
+
+const WeeklySummaryJob = "weekly_summary"
+
+// StartWeeklySummary emails each client with an address a summary of the past
+// week, on Monday from 08:00 in their time zone. It checks every hour; the email
+// queue drops repeats for the same week.
+func StartWeeklySummary() {
+	go func() {
+		runWeeklySummary()
+
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			runWeeklySummary()
+		}
+	}()
+}
+
+func runWeeklySummary() {
+	now := time.Now()
+
+	var zones []string
+	if err := config.DB.Model(&models.User{}).Distinct().Pluck("U_TimeZone", &zones).Error; err != nil {
+		recordRun(WeeklySummaryJob, 0, err)
+		return
+	}
+
+	var queued int64
+	for _, zone := range zones {
+		local := now.In(utils.UserLocation(zone))
+		if local.Weekday() != time.Monday || local.Hour() < 8 {
+			continue
+		}
+		from := local.AddDate(0, 0, -7).Format("2006-01-02")
+		to := local.AddDate(0, 0, -1).Format("2006-01-02")
+
+		var users []models.User
+		if err := config.DB.
+			Where("U_TimeZone = ? AND U_Role = ? AND U_DeactivatedAt IS NULL AND U_Email <> ''", zone, "User").
+			Find(&users).Error; err != nil {
+			recordRun(WeeklySummaryJob, queued, err)
+			return
+		}
+
+		for _, user := range users {
+			var days []models.DailyIntake
+			config.DB.Select("DI_Date", "DI_TotalCalories").
+				Where("CustomerUsers_U_ID = ? AND DI_Date BETWEEN ? AND ?", user.UID, from, to).
+				Order("DI_Date").
+				Find(&days)
+
+			data := mailer.WeeklySummaryData{
+				Name:       user.Username,
+				From:       from,
+				To:         to,
+				DaysLogged: len(days),
+				BMR:        int(user.BMR),
+				Link:       mailer.Link("/dashboard-user/statistics"),
+			}
+			for _, d := range days {
+				data.Total += d.DITotalCalories
+				data.Days = append(data.Days, mailer.SummaryDay{
+					Date:     d.DIDate.Format("Mon 2 Jan"),
+					Calories: d.DITotalCalories,
+					Status:   utils.IntakeStatus(d.DITotalCalories, user.BMR),
+				})
+			}
+			if len(days) > 0 {
+				data.Average = data.Total / len(days)
+			}
+
+			// Per account, since accounts sharing an address each get their own.
+			key := WeeklySummaryJob + ":" + user.UID + ":" + from
+			// Rows already queued by an earlier run today are not counted again.
+			added, err := mailer.Enqueue("weekly_summary", user.UID, user.Email, data, &key)
+			if err != nil {
+				log.Printf("weekly summary for %s: %v", user.UID, err)
+				continue
+			}
+			queued += added
+		}
+	}
+
+	recordRun(WeeklySummaryJob, queued, nil)
+}
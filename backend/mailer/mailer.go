@@ -0,0 +1,180 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers one message. Errors are retried by the queue.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// FromEnv picks the sender from MAIL_DRIVER:
+//
+//	smtp  SMTP_HOST, SMTP_PORT (587), SMTP_USERNAME, SMTP_PASSWORD
+//	file  writes .eml files to MAIL_DIR (default ./mail)
+//	log   prints messages to the server log (default)
+//
+// MAIL_FROM is the sender address for all drivers.
+func FromEnv() Sender {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "CaloriSync <no-reply@calorisync.local>"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return SMTPSender{
+			Addr:     os.Getenv("SMTP_HOST") + ":" + port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return FileSender{Dir: dir, From: from}
+	default:
+		return LogSender{From: from}
+	}
+}
+
+// SMTPSender sends through an SMTP server, using STARTTLS when the server offers
+// it. Without SMTP_USERNAME no authentication is attempted, which suits local
+// catch-all servers such as MailHog.
+type SMTPSender struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host := s.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	body, err := encode(s.From, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, auth, address(s.From), []string{msg.To}, body)
+}
+
+// FileSender writes every message as an .eml file, for development.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s FileSender) Send(msg Message) error {
+	body, err := encode(s.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405"), uuid.NewString()[:8])
+	return os.WriteFile(filepath.Join(s.Dir, name), body, 0o644)
+}
+
+// LogSender only logs messages, so nothing leaves the machine.
+type LogSender struct {
+	From string
+}
+
+func (s LogSender) Send(msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// address strips the display name from "Name <addr>".
+func address(from string) string {
+	if i := strings.Index(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
+
+// encode builds a multipart/alternative message with text and HTML parts.
+func encode(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", uuid.NewString(), domain(from))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, p := range parts {
+		if p.body == "" {
+			continue
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func domain(from string) string {
+	addr := address(from)
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[i+1:]
+	}
+	return "localhost"
+}
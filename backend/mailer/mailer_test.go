@@ -0,0 +1,166 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpStub is a local stand-in for an SMTP server that records one transaction.
+type smtpStub struct {
+	addr string
+	from string
+	rcpt []string
+	data string
+	done chan struct{}
+}
+
+func startSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	stub := &smtpStub{addr: ln.Addr().String(), done: make(chan struct{})}
+	go func() {
+		defer close(stub.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 stub ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				tp.PrintfLine("250-stub")
+				tp.PrintfLine("250 8BITMIME")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				stub.from = strings.Fields(line[len("MAIL FROM:"):])[0]
+				tp.PrintfLine("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				stub.rcpt = append(stub.rcpt, line[len("RCPT TO:"):])
+				tp.PrintfLine("250 OK")
+			case cmd == "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				stub.data = string(data)
+				tp.PrintfLine("250 queued")
+			case cmd == "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return stub
+}
+
+func TestSMTPSenderSendsMultipartMessage(t *testing.T) {
+	stub := startSMTPStub(t)
+
+	sender := SMTPSender{Addr: stub.addr, From: "CaloriSync <no-reply@calorisync.local>"}
+	msg := Message{
+		To:      "ann@example.com",
+		Subject: "Komentar baru ✓",
+		Text:    "Hi Ann,\n\n" + strings.Repeat("long line ", 20) + "\n",
+		HTML:    "<p>Hi Ann,</p>",
+	}
+	if err := sender.Send(msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	<-stub.done
+
+	if stub.from != "<no-reply@calorisync.local>" {
+		t.Errorf("MAIL FROM = %q, want the bare sender address", stub.from)
+	}
+	if len(stub.rcpt) != 1 || stub.rcpt[0] != "<ann@example.com>" {
+		t.Errorf("RCPT TO = %q, want only <ann@example.com>", stub.rcpt)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(stub.data))
+	if err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	if got := parsed.Header.Get("From"); got != sender.From {
+		t.Errorf("From = %q, want %q", got, sender.From)
+	}
+	if got := parsed.Header.Get("To"); got != msg.To {
+		t.Errorf("To = %q, want %q", got, msg.To)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@calorisync.local>") {
+		t.Errorf("Message-ID = %q, want one in the sender's domain", parsed.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/alternative", parsed.Header.Get("Content-Type"), err)
+	}
+
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, w := range want {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("reading %s part: %v", w.contentType, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != w.contentType {
+			t.Errorf("part Content-Type = %q, want %q", got, w.contentType)
+		}
+		body, _ := io.ReadAll(part) // quoted-printable is decoded by the reader
+		if string(body) != w.body {
+			t.Errorf("%s body = %q, want %q", w.contentType, body, w.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("expected exactly two parts, got more (%v)", err)
+	}
+}
+
+func TestEncodeSkipsEmptyHTML(t *testing.T) {
+	data, err := encode("no-reply@calorisync.local", Message{To: "ann@example.com", Subject: "s", Text: "only text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "text/html") {
+		t.Error("message without HTML should only have a text part")
+	}
+}
+
+func TestAddress(t *testing.T) {
+	cases := map[string]string{
+		"CaloriSync <no-reply@calorisync.local>": "no-reply@calorisync.local",
+		"no-reply@calorisync.local":              "no-reply@calorisync.local",
+	}
+	for in, want := range cases {
+		if got := address(in); got != want {
+			t.Errorf("address(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
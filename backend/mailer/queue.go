@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Enqueue renders the template and puts the email for user userID in the outbox;
+// the email queue job sends it. Nothing is queued when to is empty. With a key, a
+// second email with the same key to the same address is dropped. It returns how
+// many emails were queued, 0 or 1.
+func Enqueue(name string, userID string, to string, data interface{}, key *string) (int64, error) {
+	if to == "" {
+		return 0, nil
+	}
+
+	msg, err := Render(name, to, data)
+	if err != nil {
+		return 0, err
+	}
+
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.EmailJob{
+		UserID:          userID,
+		EJTo:            msg.To,
+		EJKey:           key,
+		EJSubject:       msg.Subject,
+		EJText:          msg.Text,
+		EJHTML:          msg.HTML,
+		EJStatus:        models.EmailPending,
+		EJNextAttemptAt: time.Now(),
+	})
+	return result.RowsAffected, result.Error
+}
+
+// SendDue sends up to limit emails that are due and returns how many went out.
+// A failed send is retried with exponential backoff starting at one minute, until
+// MAIL_MAX_ATTEMPTS (default 5) is reached.
+func SendDue(sender Sender, limit int) (int64, error) {
+	maxAttempts := config.EnvInt("MAIL_MAX_ATTEMPTS", 5)
+
+	var due []models.EmailJob
+	if err := config.DB.
+		Where("EJ_Status = ? AND EJ_NextAttemptAt <= ?", models.EmailPending, time.Now()).
+		Order("EJ_NextAttemptAt").
+		Limit(limit).
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	var sent int64
+	for _, job := range due {
+		updates, ok := attempt(sender, job, maxAttempts, time.Now())
+		if ok {
+			sent++
+		}
+		if err := config.DB.Model(&job).Updates(updates).Error; err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// attempt sends one job and returns the columns to update, and whether it went
+// out. After the n-th failure the next try is 2^(n-1) minutes later; the job is
+// marked failed once maxAttempts is reached.
+func attempt(sender Sender, job models.EmailJob, maxAttempts int, now time.Time) (map[string]interface{}, bool) {
+	err := sender.Send(Message{To: job.EJTo, Subject: job.EJSubject, Text: job.EJText, HTML: job.EJHTML})
+
+	updates := map[string]interface{}{"EJ_Attempts": job.EJAttempts + 1}
+	if err == nil {
+		updates["EJ_Status"] = models.EmailSent
+		updates["EJ_SentAt"] = now
+		return updates, true
+	}
+
+	log.Printf("mail %d to %s: attempt %d: %v", job.EJID, job.EJTo, job.EJAttempts+1, err)
+	msg := err.Error()
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	updates["EJ_LastError"] = msg
+	if job.EJAttempts+1 >= maxAttempts {
+		updates["EJ_Status"] = models.EmailFailed
+	} else {
+		backoff := time.Duration(math.Pow(2, float64(job.EJAttempts))) * time.Minute
+		updates["EJ_NextAttemptAt"] = now.Add(backoff)
+	}
+	return updates, false
+}
@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"errors"
+	"fp-pbkk/models"
+	"testing"
+	"time"
+)
+
+// fakeSender records what it was asked to send and fails with err when set.
+type fakeSender struct {
+	err  error
+	sent []Message
+}
+
+func (s *fakeSender) Send(msg Message) error {
+	s.sent = append(s.sent, msg)
+	return s.err
+}
+
+func TestAttemptSuccess(t *testing.T) {
+	now := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+	sender := &fakeSender{}
+	job := models.EmailJob{EJID: 1, EJTo: "ann@example.com", EJSubject: "Hi", EJText: "text", EJHTML: "<p>html</p>", EJAttempts: 2}
+
+	updates, ok := attempt(sender, job, 5, now)
+	if !ok {
+		t.Fatal("attempt reported failure for a send that worked")
+	}
+	if len(sender.sent) != 1 || sender.sent[0] != (Message{To: "ann@example.com", Subject: "Hi", Text: "text", HTML: "<p>html</p>"}) {
+		t.Errorf("sent %+v", sender.sent)
+	}
+	if updates["EJ_Status"] != models.EmailSent || updates["EJ_SentAt"] != now || updates["EJ_Attempts"] != 3 {
+		t.Errorf("updates = %v", updates)
+	}
+}
+
+func TestAttemptBacksOffExponentially(t *testing.T) {
+	now := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+	sender := &fakeSender{err: errors.New("451 try again later")}
+
+	for attempts, wait := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute} {
+		updates, ok := attempt(sender, models.EmailJob{EJAttempts: attempts}, 5, now)
+		if ok {
+			t.Fatalf("attempt %d reported success for a failed send", attempts+1)
+		}
+		if _, failed := updates["EJ_Status"]; failed {
+			t.Errorf("attempt %d of 5 gave up too early", attempts+1)
+		}
+		if got := updates["EJ_NextAttemptAt"]; got != now.Add(wait) {
+			t.Errorf("after attempt %d next try at %v, want %v", attempts+1, got, now.Add(wait))
+		}
+		if updates["EJ_Attempts"] != attempts+1 || updates["EJ_LastError"] != "451 try again later" {
+			t.Errorf("updates = %v", updates)
+		}
+	}
+}
+
+func TestAttemptGivesUpAfterMaxAttempts(t *testing.T) {
+	sender := &fakeSender{err: errors.New("550 no such user")}
+
+	updates, ok := attempt(sender, models.EmailJob{EJAttempts: 4}, 5, time.Now())
+	if ok {
+		t.Fatal("attempt reported success for a failed send")
+	}
+	if updates["EJ_Status"] != models.EmailFailed {
+		t.Errorf("status = %v, want %q", updates["EJ_Status"], models.EmailFailed)
+	}
+	if _, retried := updates["EJ_NextAttemptAt"]; retried {
+		t.Error("a failed job must not be scheduled again")
+	}
+}
+
+func TestAttemptTruncatesLongErrors(t *testing.T) {
+	long := make([]byte, 800)
+	for i := range long {
+		long[i] = 'x'
+	}
+	updates, _ := attempt(&fakeSender{err: errors.New(string(long))}, models.EmailJob{}, 5, time.Now())
+	if got := updates["EJ_LastError"].(string); len(got) != 500 {
+		t.Errorf("stored error is %d bytes, want 500", len(got))
+	}
+}
@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each email has name.txt and name.html in templates/. The text file also
+// defines the subject as "name_subject".
+//
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+type CommentData struct {
+	Name    string
+	Author  string
+	Date    string
+	Content string
+	Link    string
+}
+
+type PasswordResetData struct {
+	Name      string
+	Link      string
+	ExpiresIn string
+}
+
+type SummaryDay struct {
+	Date     string
+	Calories int
+	Status   string
+}
+
+type WeeklySummaryData struct {
+	Name       string
+	From       string
+	To         string
+	DaysLogged int
+	Total      int
+	Average    int
+	BMR        int
+	Days       []SummaryDay
+	Link       string
+}
+
+// Link turns a frontend path into an absolute URL using FRONTEND_URL.
+func Link(path string) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// Render fills the named template for one recipient.
+func Render(name string, to string, data interface{}) (Message, error) {
+	msg := Message{To: to}
+
+	var buf bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&buf, name+".txt", data); err != nil {
+		return msg, err
+	}
+	msg.Text = buf.String()
+
+	buf.Reset()
+	if err := textTemplates.ExecuteTemplate(&buf, name+"_subject", data); err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := htmlTemplates.ExecuteTemplate(&buf, name+".html", data); err != nil {
+		return msg, err
+	}
+	msg.HTML = buf.String()
+
+	return msg, nil
+}
@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    interface{}
+		subject string
+		text    []string
+		html    []string
+	}{
+		{
+			name: "comment",
+			data: CommentData{
+				Name:    "Ann",
+				Author:  "dr_budi",
+				Date:    "6 Jan 2025",
+				Content: "Less <b>rice</b> & more veg",
+				Link:    "http://localhost:3000/dashboard-user/intakeLogs",
+			},
+			subject: "dr_budi commented on your log for 6 Jan 2025",
+			text:    []string{"Hi Ann,", "Less <b>rice</b> & more veg", "http://localhost:3000/dashboard-user/intakeLogs"},
+			html:    []string{"<strong>dr_budi</strong>", "Less &lt;b&gt;rice&lt;/b&gt; &amp; more veg", "<!DOCTYPE html>"},
+		},
+		{
+			name: "password_reset",
+			data: PasswordResetData{
+				Name:      "Ann",
+				Link:      "http://localhost:3000/authentication/reset-password?token=abc",
+				ExpiresIn: "60 minutes",
+			},
+			subject: "Reset your CaloriSync password",
+			text:    []string{"Hi Ann,", "within 60 minutes", "reset-password?token=abc"},
+			html:    []string{`href="http://localhost:3000/authentication/reset-password?token=abc"`, "within 60 minutes"},
+		},
+		{
+			name: "weekly_summary",
+			data: WeeklySummaryData{
+				Name:       "Ann",
+				From:       "30 Dec",
+				To:         "5 Jan",
+				DaysLogged: 2,
+				Total:      3700,
+				Average:    1850,
+				BMR:        1600,
+				Days: []SummaryDay{
+					{Date: "Mon 30 Dec", Calories: 1700, Status: "Normal"},
+					{Date: "Tue 31 Dec", Calories: 2000, Status: "Surplus"},
+				},
+				Link: "http://localhost:3000/dashboard-user/statistics",
+			},
+			subject: "Your week in CaloriSync: 30 Dec to 5 Jan",
+			text:    []string{"Days logged: 2 of 7", "Average: 1850 kcal per logged day (BMR 1600 kcal)", "Tue 31 Dec  2000 kcal  Surplus"},
+			html:    []string{"<strong>3700</strong> kcal", "<td style=\"padding: 6px;\">Mon 30 Dec</td>", "BMR 1600 kcal"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := Render(tc.name, "ann@example.com", tc.data)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if msg.To != "ann@example.com" {
+				t.Errorf("To = %q", msg.To)
+			}
+			if msg.Subject != tc.subject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tc.subject)
+			}
+			for _, s := range tc.text {
+				if !strings.Contains(msg.Text, s) {
+					t.Errorf("text part is missing %q:\n%s", s, msg.Text)
+				}
+			}
+			for _, s := range tc.html {
+				if !strings.Contains(msg.HTML, s) {
+					t.Errorf("HTML part is missing %q:\n%s", s, msg.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderWeeklySummaryWithoutBMR(t *testing.T) {
+	msg, err := Render("weekly_summary", "ann@example.com", WeeklySummaryData{Name: "Ann", From: "30 Dec", To: "5 Jan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.Text, "BMR") || strings.Contains(msg.HTML, "BMR") {
+		t.Error("BMR should be left out when it is unknown")
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("no_such_email", "ann@example.com", nil); err == nil {
+		t.Error("expected an error for a template that does not exist")
+	}
+}
+
+func TestLink(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://app.example.com/")
+	if got := Link("/dashboard-user/intakeLogs"); got != "https://app.example.com/dashboard-user/intakeLogs" {
+		t.Errorf("Link = %q", got)
+	}
+
+	t.Setenv("FRONTEND_URL", "")
+	if got := Link("/x"); got != "http://localhost:3000/x" {
+		t.Errorf("Link without FRONTEND_URL = %q", got)
+	}
+}
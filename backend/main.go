@@ -2,9 +2,12 @@ package main
 
 import (
 	"fp-pbkk/config"
+	"fp-pbkk/jobs"
+	"fp-pbkk/middleware"
 	"fp-pbkk/routes"
 	"log"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -21,14 +24,27 @@ func init() {
 
 func main() {
 	config.ConnectDB()
+	jobs.StartAutoLock()
+	jobs.StartAccountPurge()
+	jobs.StartSoftDeletePurge()
+	jobs.StartLoginThrottlePurge()
+	jobs.StartMissingLogReminder()
+	jobs.StartEmailQueue()
+	jobs.StartWeeklySummary()
 
 	r := gin.Default()
+	r.Use(middleware.RequestID())
+
+	// Client IPs drive login throttling, so X-Forwarded-For is only believed from known proxies.
+	if err := r.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
 
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
+		AllowOrigins:     config.AllowedOrigins(),
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Request-ID", "If-Match"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
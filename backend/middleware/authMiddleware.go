@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"fp-pbkk/config"
+	"fp-pbkk/models"
 	"fp-pbkk/utils"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -33,15 +38,132 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 3. Extract claims (User ID & Role) and attach to the request context
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			c.Set("user_id", claims["user_id"])
-			c.Set("role", claims["role"])
-		} else {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
 		}
+		// Challenge tokens and stream tickets are not sessions
+		if _, limited := claims["purpose"]; limited {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		if !activeSession(c, claims) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// twoFactorSetupRoutes are all a user who has to enroll in 2FA can reach.
+var twoFactorSetupRoutes = []string{"/api/2fa/setup", "/api/2fa/enable"}
+
+// activeSession attaches the user to the request, and answers 401 unless their
+// account is active and the token is from their current session version. Users
+// who must have 2FA but have not enrolled get 403 everywhere except the 2FA setup,
+// so sessions from before it was required cannot be used to avoid it.
+func activeSession(c *gin.Context, claims jwt.MapClaims) bool {
+	sv, _ := claims["sv"].(float64)
+	c.Set("user_id", claims["user_id"])
+	c.Set("role", claims["role"])
+	c.Set("session_version", int(sv))
+
+	if status, body := sessionProblem(c); status != 0 {
+		c.JSON(status, body)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// SessionStillActive repeats the checks of activeSession for a request that has
+// been open a while, such as an event stream or WebSocket, which must be closed
+// once the password changes or the account is deactivated.
+func SessionStillActive(c *gin.Context) bool {
+	status, _ := sessionProblem(c)
+	return status == 0
+}
+
+// sessionProblem returns the status and error to answer with when the session
+// attached to c may not be used, or a zero status when it may.
+func sessionProblem(c *gin.Context) (int, gin.H) {
+	// Reject tokens of accounts that were deactivated or purged since they were issued
+	var user models.User
+	if err := config.DB.Select("U_ID", "U_Role", "U_DeactivatedAt", "U_SessionVersion", "U_TOTPEnabled").Where("U_ID = ?", c.GetString("user_id")).First(&user).Error; err != nil || user.DeactivatedAt != nil {
+		return http.StatusUnauthorized, gin.H{"error": "Account is not active"}
+	}
+
+	// Reject tokens issued before the password was changed or reset
+	if c.GetInt("session_version") != user.SessionVersion {
+		return http.StatusUnauthorized, gin.H{"error": "Session expired, please log in again"}
+	}
+
+	if config.TwoFactorRequired(user.Role) && !user.TOTPEnabled && !slices.Contains(twoFactorSetupRoutes, c.FullPath()) {
+		return http.StatusForbidden, gin.H{
+			"error":                     "Two-factor authentication is required, set it up first",
+			"two_factor_setup_required": true,
+		}
+	}
+	return 0, nil
+}
+
+// usedTickets remembers the IDs of stream tickets until they expire, so each one
+// opens a single connection.
+var usedTickets = struct {
+	sync.Mutex
+	m map[string]time.Time
+}{m: map[string]time.Time{}}
+
+func claimTicket(id string, expires time.Time) bool {
+	usedTickets.Lock()
+	defer usedTickets.Unlock()
+
+	now := time.Now()
+	for k, exp := range usedTickets.m {
+		if exp.Before(now) {
+			delete(usedTickets.m, k)
+		}
+	}
+	if _, used := usedTickets.m[id]; used {
+		return false
+	}
+	usedTickets.m[id] = expires
+	return true
+}
 
+// StreamAuth guards the EventSource and WebSocket endpoints. Browsers cannot set
+// headers on those, so besides the usual Authorization header they accept a
+// single-use ?ticket= from POST /stream-tickets, issued for purpose.
+func StreamAuth(purpose string) gin.HandlerFunc {
+	session := AuthMiddleware()
+
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			session(c)
+			return
+		}
+
+		claims, err := utils.ParseStreamTicket(ticket, purpose)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+			c.Abort()
+			return
+		}
+		id, _ := claims["jti"].(string)
+		exp, _ := claims.GetExpirationTime()
+		if id == "" || exp == nil || !claimTicket(id, exp.Time) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Ticket was already used"})
+			c.Abort()
+			return
+		}
+
+		if !activeSession(c, claims) {
+			return
+		}
 		c.Next()
 	}
 }
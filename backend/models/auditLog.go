@@ -0,0 +1,34 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAuditAppendOnly = errors.New("audit log is append-only")
+
+type AuditLog struct {
+	ALID       uint      `gorm:"primaryKey;autoIncrement;column:AL_ID" json:"al_id"`
+	ActorID    string    `gorm:"column:AL_ActorID;type:varchar(36);index" json:"actor_id"`
+	ActorRole  string    `gorm:"column:AL_ActorRole;type:varchar(20)" json:"actor_role"`
+	Action     string    `gorm:"column:AL_Action;type:varchar(50)" json:"action"`
+	EntityType string    `gorm:"column:AL_EntityType;type:varchar(50);index:idx_audit_entity" json:"entity_type"`
+	EntityID   string    `gorm:"column:AL_EntityID;type:varchar(50);index:idx_audit_entity" json:"entity_id"`
+	SubjectID  string    `gorm:"column:AL_SubjectID;type:varchar(36);index" json:"subject_id"` // user whose data changed
+	Before     string    `gorm:"column:AL_Before;type:text" json:"before"`
+	After      string    `gorm:"column:AL_After;type:text" json:"after"`
+	RequestID  string    `gorm:"column:AL_RequestID;type:varchar(64)" json:"request_id"`
+	CreatedAt  time.Time `gorm:"column:AL_CreatedAt;autoCreateTime" json:"created_at"`
+}
+
+// Entries are never changed through normal writes. The one exception is the
+// account purge, which skips these hooks to blank out a purged user's data.
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// CommentRead is how far a participant has read the comments of a day. Comments by
+// others created after CRReadAt count as unread.
+type CommentRead struct {
+	CRID          uint      `gorm:"primaryKey;autoIncrement;column:CR_ID" json:"cr_id"`
+	DailyIntakeID string    `gorm:"column:Daily_Intakes_DI_ID;type:varchar(50);uniqueIndex:idx_comment_read_day_user,priority:1" json:"di_id"`
+	UserID        string    `gorm:"column:U_ID;type:varchar(36);uniqueIndex:idx_comment_read_day_user,priority:2" json:"user_id"`
+	CRReadAt      time.Time `gorm:"column:CR_ReadAt" json:"read_at"`
+}
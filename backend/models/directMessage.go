@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// DirectMessage is a private chat message between a nutritionist and one of their clients.
+type DirectMessage struct {
+	DMID          uint       `gorm:"primaryKey;autoIncrement;column:DM_ID" json:"dm_id"`
+	SenderID      string     `gorm:"column:DM_SenderID;type:varchar(36);index:idx_dm_pair,priority:1" json:"sender_id"`
+	RecipientID   string     `gorm:"column:DM_RecipientID;type:varchar(36);index:idx_dm_pair,priority:2;index" json:"recipient_id"`
+	DMContent     string     `gorm:"column:DM_Content;type:text" json:"content"`
+	DMCreatedAt   time.Time  `gorm:"column:DM_CreatedAt;autoCreateTime" json:"created_at"`
+	DMDeliveredAt *time.Time `gorm:"column:DM_DeliveredAt" json:"delivered_at"`
+	DMReadAt      *time.Time `gorm:"column:DM_ReadAt" json:"read_at"`
+}
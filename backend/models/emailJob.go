@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed" // gave up after the last attempt
+)
+
+// EmailJob is a rendered email waiting in the outbox. Key, when set, keeps the
+// same email from being queued twice for the same recipient. UserID is the account
+// it was sent for, since several accounts may share an address.
+type EmailJob struct {
+	EJID            uint       `gorm:"primaryKey;autoIncrement;column:EJ_ID" json:"ej_id"`
+	UserID          string     `gorm:"column:U_ID;type:varchar(36);index" json:"user_id"`
+	EJTo            string     `gorm:"column:EJ_To;type:varchar(255);uniqueIndex:idx_email_key,priority:1" json:"to"`
+	EJKey           *string    `gorm:"column:EJ_Key;type:varchar(100);uniqueIndex:idx_email_key,priority:2" json:"key,omitempty"`
+	EJSubject       string     `gorm:"column:EJ_Subject;type:varchar(255)" json:"subject"`
+	EJText          string     `gorm:"column:EJ_Text;type:text" json:"-"`
+	EJHTML          string     `gorm:"column:EJ_HTML;type:mediumtext" json:"-"`
+	EJStatus        string     `gorm:"column:EJ_Status;type:varchar(10);default:pending;index:idx_email_due,priority:1" json:"status"`
+	EJAttempts      int        `gorm:"column:EJ_Attempts;type:int;default:0" json:"attempts"`
+	EJNextAttemptAt time.Time  `gorm:"column:EJ_NextAttemptAt;index:idx_email_due,priority:2" json:"next_attempt_at"`
+	EJLastError     string     `gorm:"column:EJ_LastError;type:varchar(500)" json:"last_error,omitempty"`
+	EJSentAt        *time.Time `gorm:"column:EJ_SentAt" json:"sent_at,omitempty"`
+	EJCreatedAt     time.Time  `gorm:"column:EJ_CreatedAt;autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// JobRun keeps the outcome of the last run of each background job.
+type JobRun struct {
+	JRName      string    `gorm:"primaryKey;column:JR_Name;type:varchar(50)" json:"name"`
+	JRLastRunAt time.Time `gorm:"column:JR_LastRunAt" json:"last_run_at"`
+	JRStatus    string    `gorm:"column:JR_Status;type:varchar(20)" json:"status"` // "ok" or "failed"
+	JRError     string    `gorm:"column:JR_Error;type:varchar(255)" json:"error"`
+	JRAffected  int64     `gorm:"column:JR_Affected;type:int" json:"affected"`
+}
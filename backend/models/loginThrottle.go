@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginThrottle counts recent failed logins for one key: "user:<username>" or
+// "ip:<address>". Counting by the name that was typed, not the account, means
+// unknown usernames are throttled exactly like real ones. Password reset requests
+// are counted the same way under "reset:user:<user id>" and "reset:ip:<address>".
+type LoginThrottle struct {
+	LTKey           string     `gorm:"primaryKey;column:LT_Key;type:varchar(120)" json:"key"`
+	LTFailures      int        `gorm:"column:LT_Failures;type:int;default:0" json:"failures"`
+	LTLastFailureAt time.Time  `gorm:"column:LT_LastFailureAt" json:"last_failure_at"`
+	LTLockedUntil   *time.Time `gorm:"column:LT_LockedUntil" json:"locked_until,omitempty"`
+}
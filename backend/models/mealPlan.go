@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ClientAssignment pairs a nutritionist with a client. The nutritionist asks, and
+// the pairing only grants access to the client's data once the client accepts.
+type ClientAssignment struct {
+	CAID           uint       `gorm:"primaryKey;autoIncrement;column:CA_ID" json:"ca_id"`
+	NutritionistID string     `gorm:"column:NutritionistUsers_U_ID;type:varchar(36);uniqueIndex:idx_assignment_pair" json:"nutritionist_id"`
+	CustomerUserID string     `gorm:"column:CustomerUsers_U_ID;type:varchar(36);uniqueIndex:idx_assignment_pair" json:"user_id"`
+	CAAcceptedAt   *time.Time `gorm:"column:CA_AcceptedAt;index" json:"accepted_at"` // nil while waiting for the client
+
+	CustomerUser User `gorm:"foreignKey:CustomerUserID;references:UID" json:"customer_user"`
+}
+
+// AcceptedAssignments limits a ClientAssignment query to pairings the client has
+// accepted. Every access check must go through it.
+func AcceptedAssignments(db *gorm.DB) *gorm.DB {
+	return db.Where("CA_AcceptedAt IS NOT NULL")
+}
+
+type MealPlan struct {
+	MPID           string    `gorm:"primaryKey;column:MP_ID;type:varchar(50)" json:"mp_id"`
+	MPName         string    `gorm:"column:MP_Name;type:varchar(100)" json:"name"`
+	MPStartDate    time.Time `gorm:"column:MP_StartDate;type:date" json:"start_date"`
+	MPEndDate      time.Time `gorm:"column:MP_EndDate;type:date" json:"end_date"`
+	NutritionistID string    `gorm:"column:NutritionistUsers_U_ID;type:varchar(36)" json:"nutritionist_id"`
+	CustomerUserID string    `gorm:"column:CustomerUsers_U_ID;type:varchar(36);index" json:"user_id"`
+
+	PlannedMeals []PlannedMeal `gorm:"foreignKey:MealPlanID" json:"planned_meals"`
+}
+
+type PlannedMeal struct {
+	PMID       string    `gorm:"primaryKey;column:PM_ID;type:varchar(50)" json:"pm_id"`
+	MealPlanID string    `gorm:"column:Meal_Plans_MP_ID;type:varchar(50);index" json:"mp_id"`
+	PMDate     time.Time `gorm:"column:PM_Date;type:date" json:"date"`
+	PMSlot     string    `gorm:"column:PM_Slot;type:varchar(20)" json:"slot"` // breakfast, lunch, dinner or snack
+	PMFoodName string    `gorm:"column:PM_FoodName;type:varchar(100)" json:"food_name"`
+	PMPortion  string    `gorm:"column:PM_Portion;type:varchar(50)" json:"portion"`
+	PMCalories int       `gorm:"column:PM_Calories;type:int" json:"calories"`
+}
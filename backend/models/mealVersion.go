@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// MealVersion is a snapshot of a meal taken right before it was edited.
+type MealVersion struct {
+	MVID        uint      `gorm:"primaryKey;autoIncrement;column:MV_ID" json:"mv_id"`
+	MealID      string    `gorm:"column:Meals_M_ID;type:varchar(50);uniqueIndex:idx_meal_version" json:"meal_id"`
+	MVVersion   int       `gorm:"column:MV_Version;type:int;uniqueIndex:idx_meal_version" json:"version"`
+	MVFoodName  string    `gorm:"column:MV_FoodName;type:varchar(100)" json:"food_name"`
+	MVCalories  int       `gorm:"column:MV_Calories;type:int" json:"calories"`
+	MVProtein   float64   `gorm:"column:MV_Protein;type:decimal(6,2)" json:"protein"`
+	MVCarbs     float64   `gorm:"column:MV_Carbs;type:decimal(6,2)" json:"carbs"`
+	MVFat       float64   `gorm:"column:MV_Fat;type:decimal(6,2)" json:"fat"`
+	MVTime      string    `gorm:"column:MV_Time;type:varchar(10)" json:"time"`
+	EditedBy    string    `gorm:"column:MV_EditedBy;type:varchar(36)" json:"edited_by"`
+	MVCreatedAt time.Time `gorm:"column:MV_CreatedAt;autoCreateTime" json:"edited_at"` // when this version was replaced
+}
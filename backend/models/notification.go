@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification is an entry in a user's inbox. Key, when set, makes the notification
+// one-off: a second one with the same key for the same user is not stored.
+type Notification struct {
+	NID        uint       `gorm:"primaryKey;autoIncrement;column:N_ID" json:"n_id"`
+	UserID     string     `gorm:"column:U_ID;type:varchar(36);index;uniqueIndex:idx_notification_key,priority:1" json:"user_id"`
+	NType      string     `gorm:"column:N_Type;type:varchar(40)" json:"type"`
+	NTitle     string     `gorm:"column:N_Title;type:varchar(150)" json:"title"`
+	NBody      string     `gorm:"column:N_Body;type:varchar(255)" json:"body"`
+	NLink      string     `gorm:"column:N_Link;type:varchar(255)" json:"link,omitempty"` // frontend path to open
+	NKey       *string    `gorm:"column:N_Key;type:varchar(100);uniqueIndex:idx_notification_key,priority:2" json:"-"`
+	NReadAt    *time.Time `gorm:"column:N_ReadAt" json:"read_at"`
+	NCreatedAt time.Time  `gorm:"column:N_CreatedAt;autoCreateTime;index" json:"created_at"`
+}
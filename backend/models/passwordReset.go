@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordReset is a single-use reset link. Only the SHA-256 of the token is
+// stored, so the table alone cannot be used to reset anyone's password.
+type PasswordReset struct {
+	PRID        uint       `gorm:"primaryKey;autoIncrement;column:PR_ID" json:"pr_id"`
+	UserID      string     `gorm:"column:U_ID;type:varchar(36);index" json:"user_id"`
+	PRTokenHash string     `gorm:"column:PR_TokenHash;type:char(64);uniqueIndex" json:"-"`
+	PRExpiresAt time.Time  `gorm:"column:PR_ExpiresAt" json:"expires_at"`
+	PRUsedAt    *time.Time `gorm:"column:PR_UsedAt" json:"used_at"`
+	PRCreatedAt time.Time  `gorm:"column:PR_CreatedAt;autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when the
+// authenticator is lost. Only its SHA-256 is stored.
+type RecoveryCode struct {
+	RCID       uint       `gorm:"primaryKey;autoIncrement;column:RC_ID" json:"rc_id"`
+	UserID     string     `gorm:"column:U_ID;type:varchar(36);index" json:"user_id"`
+	RCCodeHash string     `gorm:"column:RC_CodeHash;type:char(64)" json:"-"`
+	RCUsedAt   *time.Time `gorm:"column:RC_UsedAt" json:"used_at"`
+}
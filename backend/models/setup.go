@@ -2,12 +2,15 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type User struct {
 	UID      string  `gorm:"primaryKey;column:U_ID;type:varchar(36)" json:"u_id"`
 	Username string  `gorm:"column:U_Username;type:varchar(50);unique" json:"username"`
 	Password string  `gorm:"column:U_Password;type:varchar(255)" json:"-"`
+	Email    string  `gorm:"column:U_Email;type:varchar(255);index" json:"-"` // optional, used for email notifications; only shown by GetProfile
 	Role     string  `gorm:"column:U_Role;type:varchar(20)" json:"role"`
 	Height   float64 `gorm:"column:U_Height;type:decimal(5,2)" json:"height"`
 	Weight   float64 `gorm:"column:U_Weight;type:decimal(5,2)" json:"weight"`
@@ -15,34 +18,100 @@ type User struct {
 	Gender   string  `gorm:"column:U_Gender;type:varchar(10)" json:"gender"`
 	BMI      float64 `gorm:"column:U_BMI;type:decimal(5,2)" json:"bmi"`
 	BMR      float64 `gorm:"column:U_BMR;type:decimal(8,2)" json:"bmr"`
+	TimeZone string  `gorm:"column:U_TimeZone;type:varchar(64);default:UTC" json:"time_zone"` // IANA name, e.g. "Asia/Jakarta"
+
+	// Set when the user asks for deletion; everything is purged after PurgeAfter.
+	DeactivatedAt *time.Time `gorm:"column:U_DeactivatedAt" json:"deactivated_at,omitempty"`
+	PurgeAfter    *time.Time `gorm:"column:U_PurgeAfter;index" json:"purge_after,omitempty"`
+
+	// Part of every token; bumping it signs the user out everywhere.
+	SessionVersion int `gorm:"column:U_SessionVersion;type:int;default:0" json:"-"`
+
+	// TOTP two-factor login. The secret is set at enrollment and only counts once
+	// TOTPEnabled is true; TOTPLastStep stops a code from being used twice.
+	TOTPSecret   string `gorm:"column:U_TOTPSecret;type:varchar(64)" json:"-"`
+	TOTPEnabled  bool   `gorm:"column:U_TOTPEnabled;default:false" json:"-"`
+	TOTPLastStep int64  `gorm:"column:U_TOTPLastStep;default:0" json:"-"`
+}
+
+// UserSummary is how a user appears inside someone else's data, e.g. as the
+// author of a comment: no profile, health or contact details.
+type UserSummary struct {
+	UID      string `gorm:"primaryKey;column:U_ID" json:"u_id"`
+	Username string `gorm:"column:U_Username" json:"username"`
+	Role     string `gorm:"column:U_Role" json:"role"`
+}
+
+func (UserSummary) TableName() string {
+	return "users"
 }
 
 type DailyIntake struct {
 	DIID            string    `gorm:"primaryKey;column:DI_ID;type:varchar(50)" json:"di_id"`
-	DIDate          time.Time `gorm:"column:DI_Date;type:date" json:"di_date"`
+	DIDate          time.Time `gorm:"column:DI_Date;type:date;uniqueIndex:idx_intake_user_date,priority:2" json:"di_date"`
 	DITotalCalories int       `gorm:"column:DI_TotalCalories;type:int;default:0" json:"total_calories"`
 	DIIsLocked      bool      `gorm:"column:DI_isLocked;type:boolean;default:false" json:"is_locked"`
-	CustomerUserID  string    `gorm:"column:CustomerUsers_U_ID;type:varchar(50)" json:"user_id"`
+	CustomerUserID  string    `gorm:"column:CustomerUsers_U_ID;type:varchar(50);uniqueIndex:idx_intake_user_date,priority:1" json:"user_id"`
+	DIVersion       int       `gorm:"column:DI_Version;type:int;default:1" json:"version"` // bumped on every change to the day or its meals
 
 	CustomerUser User      `gorm:"foreignKey:CustomerUserID;references:UID" json:"customer_user"`
 	Meals        []Meal    `gorm:"foreignKey:DailyIntakeID" json:"meals"`
 	Comments     []Comment `gorm:"foreignKey:DailyIntakeID" json:"comments"`
+
+	// Filled from the client's meal plans when the day is read, not stored.
+	PlannedMeals    []PlannedMeal `gorm:"-" json:"planned_meals,omitempty"`
+	PlannedCalories int           `gorm:"-" json:"planned_calories,omitempty"`
+	Adherence       *float64      `gorm:"-" json:"adherence,omitempty"`
+
+	// True when a meal of the day was edited after a nutritionist first commented.
+	EditedAfterComment bool `gorm:"-" json:"edited_after_comment"`
+
+	// Comments by others the requesting user has not read yet.
+	UnreadComments int `gorm:"-" json:"unread_comments"`
 }
 
 type Meal struct {
-	MID           string `gorm:"primaryKey;column:M_ID;type:varchar(50)" json:"M_ID"`
-	MFoodName     string `gorm:"column:M_FoodName;type:varchar(100)" json:"food_name"`
-	MCalories     int    `gorm:"column:M_Calories;type:int" json:"calories"`
-	DailyIntakeID string `gorm:"column:Daily_Intakes_DI_ID;type:varchar(20)" json:"di_id"`
-	Time          string `json:"time" gorm:"column:time"`
-	UID           string `gorm:"column:U_ID" json:"user_id"`
+	MID           string  `gorm:"primaryKey;column:M_ID;type:varchar(50)" json:"M_ID"`
+	MFoodName     string  `gorm:"column:M_FoodName;type:varchar(100)" json:"food_name"`
+	MCalories     int     `gorm:"column:M_Calories;type:int" json:"calories"`
+	MProtein      float64 `gorm:"column:M_Protein;type:decimal(6,2);default:0" json:"protein"`
+	MCarbs        float64 `gorm:"column:M_Carbs;type:decimal(6,2);default:0" json:"carbs"`
+	MFat          float64 `gorm:"column:M_Fat;type:decimal(6,2);default:0" json:"fat"`
+	DailyIntakeID string  `gorm:"column:Daily_Intakes_DI_ID;type:varchar(20)" json:"di_id"`
+	Time          string  `json:"time" gorm:"column:time"`
+	UID           string  `gorm:"column:U_ID" json:"user_id"`
+	MVersion      int     `gorm:"column:M_Version;type:int;default:1" json:"version"`
+
+	DeletedAt gorm.DeletedAt `gorm:"column:M_DeletedAt;index" json:"deleted_at,omitempty"`
+
+	Comments []Comment `gorm:"foreignKey:MealID" json:"comments,omitempty"`
+
+	EditedAfterComment bool `gorm:"-" json:"edited_after_comment"`
 }
 
 type Comment struct {
-	CID            uint   `gorm:"primaryKey;autoIncrement" json:"c_id"`
-	CContent       string `gorm:"column:C_Content;type:varchar(150)" json:"content"`
-	NutritionistID string `gorm:"column:NutritionistUsers_U_ID;type:varchar(36)" json:"nutritionist_id"`
-	DailyIntakeID  string `gorm:"column:Daily_Intakes_DI_ID;type:varchar(50)" json:"di_id"`
+	CID            uint    `gorm:"primaryKey;autoIncrement" json:"c_id"`
+	CContent       string  `gorm:"column:C_Content;type:varchar(150)" json:"content"`
+	NutritionistID string  `gorm:"column:NutritionistUsers_U_ID;type:varchar(36)" json:"nutritionist_id"` // only set when a nutritionist wrote it
+	DailyIntakeID  string  `gorm:"column:Daily_Intakes_DI_ID;type:varchar(50)" json:"di_id"`
+	MealID         *string `gorm:"column:Meals_M_ID;type:varchar(50);index" json:"meal_id"` // nil for comments on the whole day
+	ParentID       *uint   `gorm:"column:C_ParentID;index" json:"parent_id"`
+	AuthorID       string  `gorm:"column:C_AuthorID;type:varchar(36);index" json:"author_id"`
+	AuthorRole     string  `gorm:"column:C_AuthorRole;type:varchar(20)" json:"author_role"`
+
+	CreatedAt time.Time      `gorm:"column:C_CreatedAt;autoCreateTime" json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"column:C_DeletedAt;index" json:"deleted_at,omitempty"`
+
+	Nutritionist UserSummary `gorm:"foreignKey:NutritionistID;references:UID" json:"nutritionist"`
+	Author       UserSummary `gorm:"foreignKey:AuthorID;references:UID" json:"author"`
+
+	// Filled when a thread is built, not stored.
+	Replies []Comment `gorm:"-" json:"replies,omitempty"`
+}
 
-	Nutritionist User `gorm:"foreignKey:NutritionistID;references:UID" json:"nutritionist"`
+type WeightLog struct {
+	WLID         uint      `gorm:"primaryKey;autoIncrement;column:WL_ID" json:"wl_id"`
+	UserID       string    `gorm:"column:U_ID;type:varchar(36);index" json:"user_id"`
+	WLWeight     float64   `gorm:"column:WL_Weight;type:decimal(5,2)" json:"weight"`
+	WLRecordedAt time.Time `gorm:"column:WL_RecordedAt;autoCreateTime" json:"recorded_at"`
 }
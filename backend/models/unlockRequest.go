@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	UnlockPending  = "pending"
+	UnlockApproved = "approved"
+	UnlockRejected = "rejected"
+)
+
+type UnlockRequest struct {
+	URID           string     `gorm:"primaryKey;column:UR_ID;type:varchar(50)" json:"ur_id"`
+	DailyIntakeID  string     `gorm:"column:Daily_Intakes_DI_ID;type:varchar(50);index" json:"di_id"`
+	CustomerUserID string     `gorm:"column:CustomerUsers_U_ID;type:varchar(36)" json:"user_id"`
+	NutritionistID string     `gorm:"column:NutritionistUsers_U_ID;type:varchar(36)" json:"nutritionist_id"` // reviewer, set on approve/reject
+	URReason       string     `gorm:"column:UR_Reason;type:varchar(255)" json:"reason"`
+	URStatus       string     `gorm:"column:UR_Status;type:varchar(20);default:pending" json:"status"`
+	URReviewNote   string     `gorm:"column:UR_ReviewNote;type:varchar(255)" json:"review_note"`
+	URUnlockUntil  *time.Time `gorm:"column:UR_UnlockUntil" json:"unlock_until"`
+	URCreatedAt    time.Time  `gorm:"column:UR_CreatedAt;autoCreateTime" json:"created_at"`
+	URReviewedAt   *time.Time `gorm:"column:UR_ReviewedAt" json:"reviewed_at"`
+
+	CustomerUser User               `gorm:"foreignKey:CustomerUserID;references:UID" json:"customer_user"`
+	Transitions  []UnlockTransition `gorm:"foreignKey:UnlockRequestID" json:"transitions"`
+}
+
+// UnlockTransition records every status change of an UnlockRequest.
+type UnlockTransition struct {
+	UTID            uint      `gorm:"primaryKey;autoIncrement;column:UT_ID" json:"ut_id"`
+	UnlockRequestID string    `gorm:"column:Unlock_Requests_UR_ID;type:varchar(50);index" json:"ur_id"`
+	UTFromStatus    string    `gorm:"column:UT_FromStatus;type:varchar(20)" json:"from_status"`
+	UTToStatus      string    `gorm:"column:UT_ToStatus;type:varchar(20)" json:"to_status"`
+	ActorID         string    `gorm:"column:UT_ActorID;type:varchar(36)" json:"actor_id"`
+	UTCreatedAt     time.Time `gorm:"column:UT_CreatedAt;autoCreateTime" json:"created_at"`
+}
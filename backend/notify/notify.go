@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"fp-pbkk/config"
+	"fp-pbkk/events"
+	"fp-pbkk/models"
+	"log"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// Notification types.
+const (
+	AssignmentRequested = "assignment_requested"
+	CommentAdded        = "comment_added"
+	DayLocked           = "day_locked"
+	GoalReached         = "goal_reached"
+	MissingLog          = "missing_log"
+)
+
+// Key builds a dedupe key so the same notification is only stored once.
+func Key(parts ...string) *string {
+	key := strings.Join(parts, ":")
+	return &key
+}
+
+// Send stores the notifications and pushes each new one to its user's open streams,
+// returning how many were new. Ones whose key was already used for that user are
+// skipped. Failures are logged rather than returned: a missed notification must not
+// fail the action behind it.
+func Send(notifications ...models.Notification) int {
+	sent := 0
+	for _, n := range notifications {
+		result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&n)
+		if result.Error != nil {
+			log.Printf("notify %s to %s: %v", n.NType, n.UserID, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			sent++
+			events.Publish(events.NotificationNew, n, n.UserID)
+		}
+	}
+	return sent
+}
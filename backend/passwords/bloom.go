@@ -0,0 +1,74 @@
+package passwords
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+// Bloom is a bloom filter over lower-cased strings. Has never misses a string that
+// was added, and wrongly reports a string it never saw at roughly the rate the
+// filter was sized for.
+type Bloom struct {
+	k    uint32
+	m    uint64
+	bits []byte
+}
+
+var bloomMagic = []byte("BLM1")
+
+// NewBloom sizes a filter for n strings at the given false-positive rate.
+func NewBloom(n int, falsePositive float64) *Bloom {
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositive) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &Bloom{k: k, m: m, bits: make([]byte, (m+7)/8)}
+}
+
+// positions uses double hashing over one FNV-1a sum instead of k separate hashes.
+func (b *Bloom) positions(s string, fn func(uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(s)))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	for i := uint64(0); i < uint64(b.k); i++ {
+		fn((h1 + i*h2) % b.m)
+	}
+}
+
+func (b *Bloom) Add(s string) {
+	b.positions(s, func(p uint64) { b.bits[p/8] |= 1 << (p % 8) })
+}
+
+func (b *Bloom) Has(s string) bool {
+	found := true
+	b.positions(s, func(p uint64) {
+		if b.bits[p/8]&(1<<(p%8)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+// MarshalBinary writes "BLM1", k (uint32), m (uint64), then the bit array.
+func (b *Bloom) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, 16+len(b.bits))
+	out = append(out, bloomMagic...)
+	out = binary.BigEndian.AppendUint32(out, b.k)
+	out = binary.BigEndian.AppendUint64(out, b.m)
+	return append(out, b.bits...), nil
+}
+
+func (b *Bloom) UnmarshalBinary(data []byte) error {
+	if len(data) < 16 || string(data[:4]) != string(bloomMagic) {
+		return errors.New("passwords: not a bloom filter")
+	}
+	b.k = binary.BigEndian.Uint32(data[4:8])
+	b.m = binary.BigEndian.Uint64(data[8:16])
+	if b.k == 0 || uint64(len(data)-16) != (b.m+7)/8 {
+		return errors.New("passwords: corrupt bloom filter")
+	}
+	b.bits = data[16:]
+	return nil
+}
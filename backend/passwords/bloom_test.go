@@ -0,0 +1,64 @@
+package passwords
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloomRoundTrip(t *testing.T) {
+	b := NewBloom(1000, 0.001)
+	for i := 0; i < 1000; i++ {
+		b.Add("word" + strconv.Itoa(i))
+	}
+
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Bloom
+	if err := read.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if w := "WORD" + strconv.Itoa(i); !read.Has(w) {
+			t.Fatalf("%q was added but is missing after the round trip", w)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if read.Has("other" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("%d of 10000 unknown words found, want about 10", falsePositives)
+	}
+}
+
+func TestBloomRejectsBadData(t *testing.T) {
+	good, _ := NewBloom(10, 0.01).MarshalBinary()
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"magic":     append([]byte("XXXX"), good[4:]...),
+		"truncated": good[:len(good)-1],
+	} {
+		var b Bloom
+		if err := b.UnmarshalBinary(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEmbeddedList(t *testing.T) {
+	for _, p := range []string{"password", "123456", "qwerty", "Password1", "Dragon123!", "monkey2024"} {
+		if !common.Has(p) {
+			t.Errorf("%q should be on the common list", p)
+		}
+	}
+	if common.Has("violet-harbor-crane-57") {
+		t.Error("a random passphrase should not be on the common list")
+	}
+}
@@ -0,0 +1,63 @@
+// Command gen rebuilds common.bloom from common.txt. Run it with go generate in
+// the passwords package after editing the list.
+package main
+
+import (
+	"bufio"
+	"fp-pbkk/passwords"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// suffixes are what people most often tack onto a word to get past composition
+// rules; "dragon" is in the list, so "Dragon123!" is as easy to guess.
+var suffixes = []string{"1", "12", "123", "1234", "12345", "!", "1!", "123!", "01", "69", "2023", "2024", "2025", "2026"}
+
+func main() {
+	f, err := os.Open("gen/common.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if w := strings.TrimSpace(scanner.Text()); w != "" && !strings.HasPrefix(w, "#") {
+			words = append(words, w)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	var all []string
+	add := func(w string) {
+		if w = strings.ToLower(w); !seen[w] {
+			seen[w] = true
+			all = append(all, w)
+		}
+	}
+	for _, w := range words {
+		add(w)
+		if len(w) >= 4 && strings.IndexFunc(w, func(r rune) bool { return !unicode.IsLetter(r) }) < 0 {
+			for _, s := range suffixes {
+				add(w + s)
+			}
+		}
+	}
+
+	bloom := passwords.NewBloom(len(all), 0.0001)
+	for _, w := range all {
+		bloom.Add(w)
+	}
+
+	data, _ := bloom.MarshalBinary()
+	if err := os.WriteFile("common.bloom", data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("common.bloom: %d passwords (%d listed), %d bytes", len(all), len(words), len(data))
+}
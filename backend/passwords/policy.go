@@ -0,0 +1,81 @@
+package passwords
+
+import (
+	_ "embed"
+	"fp-pbkk/config"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:generate go run ./gen
+
+// common.bloom holds the passwords in gen/common.txt, the most used passwords
+// from public breach lists plus a few local ones, and every word among them
+// followed by one of the suffixes people add most (see gen).
+//
+//go:embed common.bloom
+var commonBloom []byte
+
+var common = func() *Bloom {
+	b := &Bloom{}
+	if err := b.UnmarshalBinary(commonBloom); err != nil {
+		panic(err)
+	}
+	return b
+}()
+
+// bcrypt ignores everything past 72 bytes.
+const maxLength = 72
+
+// Check returns every rule the password breaks, as messages that can be shown to
+// the user; nil means it is acceptable. The rules are:
+//
+//	PASSWORD_MIN_LENGTH       at least this many characters (default 8)
+//	PASSWORD_MIN_CLASSES      characters from at least this many of lower case,
+//	                          upper case, digits and symbols (default 2)
+//	not longer than 72 bytes, not containing the username, not a common password
+func Check(password string, username string) []string {
+	var problems []string
+
+	minLength := config.EnvInt("PASSWORD_MIN_LENGTH", 8)
+	if len([]rune(password)) < minLength {
+		problems = append(problems, "must be at least "+strconv.Itoa(minLength)+" characters long")
+	}
+	if len(password) > maxLength {
+		problems = append(problems, "must be at most 72 bytes long")
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{lower, upper, digit, symbol} {
+		if has {
+			classes++
+		}
+	}
+	if minClasses := config.EnvInt("PASSWORD_MIN_CLASSES", 2); classes < minClasses {
+		problems = append(problems, "must mix at least "+strconv.Itoa(minClasses)+" of lower case letters, upper case letters, digits and symbols")
+	}
+
+	if username != "" && len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		problems = append(problems, "must not contain your username")
+	}
+
+	if common.Has(password) {
+		problems = append(problems, "is too common, it appears in lists of leaked passwords")
+	}
+
+	return problems
+}
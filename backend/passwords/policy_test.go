@@ -0,0 +1,52 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name     string
+		password string
+		username string
+		broken   []string
+	}{
+		{"acceptable", "violet-harbor-57", "ann", nil},
+		{"too short", "Ab1!", "ann", []string{"at least 8 characters"}},
+		{"one class", "violetharbor", "ann", []string{"must mix at least 2"}},
+		{"contains username", "xAnnabelle9-", "annabelle", []string{"must not contain your username"}},
+		{"short username is ignored", "violet-ann-57", "an", nil},
+		{"common", "Password1", "ann", []string{"too common"}},
+		{"common with suffix", "Sunshine123!", "ann", []string{"too common"}},
+		{"too long", strings.Repeat("aB3-", 19), "ann", []string{"at most 72 bytes"}},
+		{"several", "ann", "ann", []string{"at least 8 characters", "must mix at least 2", "must not contain your username"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			problems := Check(tc.password, tc.username)
+			if len(problems) != len(tc.broken) {
+				t.Fatalf("Check(%q) = %q, want %d problems", tc.password, problems, len(tc.broken))
+			}
+			for i, want := range tc.broken {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("problem %d = %q, want it to mention %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSettings(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_MIN_CLASSES", "3")
+
+	problems := Check("violet-harbor", "ann")
+	if len(problems) != 1 || !strings.Contains(problems[0], "at least 3") {
+		t.Errorf("Check = %q, want only the 3 classes rule", problems)
+	}
+	if problems := Check("violet57", "ann"); len(problems) != 2 {
+		t.Errorf("Check = %q, want the length and classes rules", problems)
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"fp-pbkk/controllers"
 	"fp-pbkk/middleware"
+	"fp-pbkk/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,31 +13,101 @@ func SetupRoutes(r *gin.Engine) {
 	{
 		public.POST("/register", controllers.Register)
 		public.POST("/login", controllers.Login)
+		public.POST("/login/2fa", controllers.LoginTwoFactor)
+		public.POST("/login/2fa/setup", controllers.LoginTwoFactorSetup)
+		public.POST("/login/2fa/enable", controllers.LoginTwoFactorEnable)
+		public.POST("/account/restore", controllers.RestoreAccount)
+		public.POST("/password/forgot", controllers.ForgotPassword)
+		public.POST("/password/reset", controllers.ResetPassword)
+	}
+
+	// EventSource and WebSocket cannot send headers, so these also take a stream ticket
+	streams := r.Group("/api")
+	{
+		streams.GET("/events", middleware.StreamAuth(utils.TicketEvents), controllers.StreamEvents)
+		streams.GET("/messages/ws", middleware.StreamAuth(utils.TicketMessages), controllers.ChatSocket)
 	}
 
 	protected := r.Group("/api")
 	protected.Use(middleware.AuthMiddleware())
 	{
+		protected.POST("/stream-tickets", controllers.CreateStreamTicket)
+
+		protected.GET("/notifications", controllers.GetNotifications)
+		protected.PATCH("/notifications/:id/read", controllers.MarkNotificationRead)
+		protected.POST("/notifications/read-all", controllers.MarkAllNotificationsRead)
+
+		// Direct messages between nutritionists and their clients
+		protected.GET("/messages/:user_id", controllers.GetMessages)
+		protected.POST("/messages/:user_id", controllers.PostMessage)
+
 		protected.GET("/me", controllers.GetCurrentUser)
 		protected.PUT("/profile", controllers.UpdateProfile)
 		protected.GET("/profile/info", controllers.GetProfile)
+		protected.DELETE("/account", controllers.DeleteAccount)
+		protected.PUT("/password", controllers.ChangePassword)
+
+		// Two-factor authentication
+		protected.POST("/2fa/setup", controllers.SetupTwoFactor)
+		protected.POST("/2fa/enable", controllers.EnableTwoFactor)
+		protected.POST("/2fa/disable", controllers.DisableTwoFactor)
+		protected.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
 
 		// Intake Routes
 		protected.GET("/intake", controllers.GetDailyIntake)
+		protected.PUT("/intake/:date", controllers.EnsureIntake)
+		protected.GET("/intakes", controllers.GetIntakeHistory)
+		protected.GET("/reports/:period", controllers.GetReport)
+		protected.GET("/export", controllers.ExportData)
+		protected.POST("/import", controllers.ImportMeals)
 
 		protected.POST("/intake/:di_id/meal", controllers.AddMeal)
 		protected.PATCH("/intake/:di_id/lock", controllers.LockIntake)
 		protected.DELETE("/intake/meal/:meal_id/delete", controllers.DeleteMeal)
 		protected.PUT("/intake/meal/:meal_id/edit", controllers.EditMeal)
+		protected.POST("/intake/meal/:meal_id/restore", controllers.RestoreMeal)
+		protected.GET("/intake/meal/:meal_id/history", controllers.GetMealHistory)
+		protected.GET("/intake/:di_id/deleted-meals", controllers.GetDeletedMeals)
+		protected.POST("/intake/:di_id/unlock-request", controllers.RequestUnlock)
+		protected.GET("/intake/:di_id/unlock-requests", controllers.GetUnlockRequests)
 
 		// Nutritionist Routes
 		protected.GET("/nutritionist/intakes", controllers.GetDashboardIntakes)
 		protected.GET("/logs/:user_id", controllers.GetUserLogs)
+		protected.GET("/logs/:user_id/pdf", controllers.GetUserLogsPDF)
 
 		protected.POST("nutritionist/comments", controllers.AddComment)
 		protected.PUT("/nutritionist/comments/:id", controllers.UpdateComment)
 		protected.DELETE("/nutritionist/comments/:id", controllers.DeleteComment)
+		protected.POST("/nutritionist/comments/:id/restore", controllers.RestoreComment)
+
+		// Day conversations, for the client and their nutritionists alike
+		protected.GET("/intake/:di_id/comments", controllers.GetDayComments)
+		protected.POST("/intake/:di_id/comments", controllers.AddDayComment)
+		protected.POST("/intake/:di_id/comments/read", controllers.MarkCommentsRead)
+		protected.PUT("/comments/:id", controllers.UpdateComment)
+		protected.DELETE("/comments/:id", controllers.DeleteComment)
+		protected.POST("/comments/:id/restore", controllers.RestoreComment)
+
+		protected.GET("/nutritionist/unlock-requests", controllers.GetNutritionistUnlockRequests)
+		protected.PATCH("/nutritionist/unlock-requests/:ur_id", controllers.ReviewUnlockRequest)
+		protected.GET("/nutritionist/auto-lock/status", controllers.GetAutoLockStatus)
+		protected.GET("/audit", controllers.GetAuditLogs)
 
 		// protected.POST("/nutritionist/comment", controllers.AddComment)
+
+		// Meal Plan Routes
+		protected.POST("/nutritionist/clients", controllers.AssignClient)
+		protected.GET("/nutritionist/clients", controllers.GetAssignedClients)
+		protected.DELETE("/nutritionist/clients/:user_id", controllers.UnassignClient)
+
+		// The client's side of assignments: accept, decline or end them
+		protected.GET("/assignments", controllers.GetMyAssignments)
+		protected.POST("/assignments/:ca_id/accept", controllers.AcceptAssignment)
+		protected.DELETE("/assignments/:ca_id", controllers.DeclineAssignment)
+
+		protected.POST("/nutritionist/plans", controllers.CreateMealPlan)
+		protected.DELETE("/nutritionist/plans/:mp_id", controllers.DeleteMealPlan)
+		protected.GET("/plans", controllers.GetMealPlans)
 	}
 }
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ETag formats a row version as a strong entity tag.
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ParseETag reads back a version from an If-Match value written by ETag.
+func ParseETag(header string) (int, bool) {
+	header = strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	v, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,11 @@
+package utils
+
+import "regexp"
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// SafeFilename replaces everything but letters, digits, '.', '_' and '-' so a
+// user-chosen name can go into a Content-Disposition header as is.
+func SafeFilename(name string) string {
+	return unsafeFilenameChars.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,11 @@
+package utils
+
+// IntakeStatus compares a day's calories against the user's BMR.
+func IntakeStatus(total int, bmr float64) string {
+	if float64(total) > bmr {
+		return "Above BMR"
+	} else if float64(total) < bmr-200 {
+		return "Below BMR"
+	}
+	return "Normal"
+}
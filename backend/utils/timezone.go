@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"time"
+)
+
+// UserLocation resolves a user's IANA time zone name, falling back to UTC.
+func UserLocation(tz string) *time.Location {
+	if tz == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LocalDate returns the calendar day of t in loc, formatted as YYYY-MM-DD.
+func LocalDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
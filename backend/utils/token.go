@@ -1,20 +1,95 @@
 package utils
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var SecretKey = []byte("CaloriSyncSuperSecretKey2025")
 
-func GenerateToken(userId string, role string) (string, error) {
+// GenerateToken issues a 24-hour token. sessionVersion must match the user's
+// current one for the token to be accepted.
+func GenerateToken(userId string, role string, sessionVersion int) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userId,
 		"role":    role,
+		"sv":      sessionVersion,
 		"exp":     time.Now().Add(time.Hour * 24).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(SecretKey)
 }
+
+// GenerateChallengeToken issues a five-minute token that only proves the password
+// was right. purpose says which step of the login it may be used for; the auth
+// middleware refuses any token that has one.
+func GenerateChallengeToken(userId string, purpose string, sessionVersion int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userId,
+		"purpose": purpose,
+		"sv":      sessionVersion,
+		"exp":     time.Now().Add(5 * time.Minute).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(SecretKey)
+}
+
+// ParseChallengeToken returns the user and session version of a valid challenge
+// token issued for purpose.
+func ParseChallengeToken(tokenString string, purpose string) (string, int, error) {
+	claims, err := parsePurposeToken(tokenString, purpose)
+	if err != nil {
+		return "", 0, err
+	}
+	userID, _ := claims["user_id"].(string)
+	sv, _ := claims["sv"].(float64)
+	return userID, int(sv), nil
+}
+
+// Stream ticket purposes, one per endpoint that takes tickets.
+const (
+	TicketEvents   = "events"
+	TicketMessages = "messages"
+)
+
+// GenerateStreamTicket issues a 30-second token that opens one EventSource or
+// WebSocket connection for purpose. Those cannot send headers, so the ticket goes
+// in the URL, where the session token must never appear.
+func GenerateStreamTicket(userId string, role string, purpose string, sessionVersion int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userId,
+		"role":    role,
+		"purpose": purpose,
+		"sv":      sessionVersion,
+		"jti":     uuid.NewString(),
+		"exp":     time.Now().Add(30 * time.Second).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(SecretKey)
+}
+
+// ParseStreamTicket returns the claims of a valid ticket issued for purpose.
+func ParseStreamTicket(tokenString string, purpose string) (jwt.MapClaims, error) {
+	return parsePurposeToken(tokenString, purpose)
+}
+
+func parsePurposeToken(tokenString string, purpose string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return SecretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return nil, errors.New("wrong token purpose")
+	}
+	return claims, nil
+}
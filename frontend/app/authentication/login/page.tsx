@@ -16,6 +16,31 @@ export default function Login() {
   const [loading, setLoading] = useState(false);
   const router = useRouter();
 
+  // Second step for accounts with two-factor authentication
+  const [challenge, setChallenge] = useState("");
+  const [setupUri, setSetupUri] = useState("");
+  const [setupSecret, setSetupSecret] = useState("");
+  const [code, setCode] = useState("");
+  const [useRecovery, setUseRecovery] = useState(false);
+
+  const finishLogin = (data: any) => {
+    localStorage.setItem("token", data.token);
+    localStorage.setItem("role", data.role);
+    localStorage.setItem("user_id", data.user_id);
+
+    if (data.recovery_codes) {
+      alert("Save these recovery codes somewhere safe, each works once:\n\n" + data.recovery_codes.join("\n"));
+    }
+
+    if (data.role === "Nutritionist") {
+      router.push("/dashboard-nutritionist");
+    } else {
+      router.push("/dashboard-user/intakeLogs");
+    }
+
+    alert("Login Successful!");
+  };
+
   const handleLogin = async (e: React.FormEvent) => {
     e.preventDefault();
     setError("");
@@ -27,17 +52,19 @@ export default function Login() {
         password: password,
       });
 
-      localStorage.setItem("token", response.data.token);
-      localStorage.setItem("role", response.data.role);
-      localStorage.setItem("user_id", response.data.user_id);
-
-      if (response.data.role === "Nutritionist") {
-        router.push("/dashboard-nutritionist"); 
-      } else {
-        router.push("/dashboard-user/intakeLogs"); 
+      if (response.data.two_factor_setup_required) {
+        const setup = await api.post("/login/2fa/setup", { challenge_token: response.data.challenge_token });
+        setSetupUri(setup.data.provisioning_uri);
+        setSetupSecret(setup.data.secret);
+        setChallenge(response.data.challenge_token);
+        return;
       }
-      
-      alert("Login Successful!");
+      if (response.data.two_factor_required) {
+        setChallenge(response.data.challenge_token);
+        return;
+      }
+
+      finishLogin(response.data);
 
     } catch (err: any) {
       setError(err.response?.data?.error || "Login failed. Please check your credentials.");
@@ -46,6 +73,29 @@ export default function Login() {
     }
   };
 
+  const handleSecondStep = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setLoading(true);
+
+    try {
+      const response = setupUri
+        ? await api.post("/login/2fa/enable", { challenge_token: challenge, code })
+        : await api.post("/login/2fa", useRecovery
+            ? { challenge_token: challenge, recovery_code: code }
+            : { challenge_token: challenge, code });
+      finishLogin(response.data);
+    } catch (err: any) {
+      if (err.response?.status === 401 && err.response?.data?.error?.includes("challenge")) {
+        setChallenge("");
+        setSetupUri("");
+      }
+      setError(err.response?.data?.error || "Verification failed.");
+    } finally {
+      setLoading(false);
+    }
+  };
+
   return (
     <>
       <HomeHeader />
@@ -69,6 +119,49 @@ export default function Login() {
             start <span className="text-[#ED9417] italic font-bold">logging</span> 
           </h1>
 
+          {challenge ? (
+          <form
+            onSubmit={handleSecondStep}
+            className="flex flex-col gap-10 px-20 mt-10 w-full max-w-2xl"
+          >
+            {setupUri ? (
+              <p className="text-lg text-[#775B2B]">
+                Nutritionist accounts need two-factor authentication. Add this key to your authenticator app,
+                then enter the code it shows:
+                <span className="block font-mono font-bold break-all mt-2">{setupSecret}</span>
+                <a href={setupUri} className="text-[#2B840B]">Open in authenticator app</a>
+              </p>
+            ) : (
+              <p className="text-lg text-[#775B2B]">
+                {useRecovery ? "Enter one of your recovery codes." : "Enter the code from your authenticator app."}
+              </p>
+            )}
+            <input
+                type="text"
+                placeholder={useRecovery ? "Recovery code" : "6-digit code"}
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                className={`${input_styles} bg-white`}
+                autoComplete="one-time-code"
+                required
+            />
+
+            {error && <p className="text-red-500 text-center font-bold">{error}</p>}
+
+            <button
+                type="submit"
+                disabled={loading}
+                className={`${input_styles} bg-[#2B840B] border-[#1E6F01] font-bold text-white hover:bg-[#5D9008] hover:text-white cursor-pointer disabled:opacity-50`}
+            >
+                {loading ? "Verifying..." : "Verify"}
+            </button>
+            {!setupUri && (
+              <button type="button" className="text-[#2B840B]" onClick={() => { setUseRecovery(!useRecovery); setCode(""); }}>
+                {useRecovery ? "Use authenticator code instead" : "Lost your device? Use a recovery code"}
+              </button>
+            )}
+          </form>
+          ) : (
           <form
             onSubmit={handleLogin}
             className="flex flex-col gap-10 px-20 mt-10 w-full max-w-2xl"
@@ -100,9 +193,13 @@ export default function Login() {
                 {loading ? "Logging in..." : "Login"}
             </button>
           </form>
+          )}
           <p className="text-xl mt-10 text-[#775B2B] font-bold">Don't have an account yet? 
             <Link href="/authentication/register" className="text-[#2B840B]"> Register here</Link>
           </p>
+          <p className="text-lg mt-4 text-[#775B2B]">
+            <Link href="/authentication/reset-password" className="text-[#2B840B]">Forgot your password?</Link>
+          </p>
 
         </div>
       </div>
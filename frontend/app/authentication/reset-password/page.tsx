@@ -0,0 +1,100 @@
+"use client";
+
+import HomeHeader from "../../../components/homeHeader";
+import Link from "next/link";
+import { Suspense, useState } from "react";
+import { useRouter, useSearchParams } from "next/navigation";
+import api from "@/utils/api";
+
+const input_styles = "border border-black border-2 rounded-lg px-5 py-5 focus:outline-none focus:ring-2 focus:ring-[#5D9008] text-lg";
+
+// Without ?token= this asks for a reset link; with it (from the email) it sets the new password.
+function ResetPasswordForm() {
+  const token = useSearchParams().get("token");
+  const [username, setUsername] = useState("");
+  const [password, setPassword] = useState("");
+  const [message, setMessage] = useState("");
+  const [error, setError] = useState("");
+  const [loading, setLoading] = useState(false);
+  const router = useRouter();
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setMessage("");
+    setLoading(true);
+
+    try {
+      if (token) {
+        await api.post("/password/reset", { token, new_password: password });
+        alert("Password reset, please log in.");
+        router.push("/authentication/login");
+      } else {
+        const response = await api.post("/password/forgot", { username });
+        setMessage(response.data.message);
+      }
+    } catch (err: any) {
+      setError(err.response?.data?.error || "Something went wrong, please try again.");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="flex flex-col items-center mt-20">
+      <h1 className="text-5xl font-bold mb-4 text-center text-[#1E6F01]">
+        {token ? "Choose a new password" : "Forgot your password?"}
+      </h1>
+
+      <form onSubmit={handleSubmit} className="flex flex-col gap-10 px-20 mt-10 w-full max-w-2xl">
+        {token ? (
+          <input
+            type="password"
+            placeholder="New password"
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            className={`${input_styles} bg-white`}
+            required
+          />
+        ) : (
+          <input
+            type="text"
+            placeholder="Username"
+            value={username}
+            onChange={(e) => setUsername(e.target.value)}
+            className={`${input_styles} bg-white`}
+            required
+          />
+        )}
+
+        {error && <p className="text-red-500 text-center font-bold">{error}</p>}
+        {message && <p className="text-[#2B840B] text-center font-bold">{message}</p>}
+
+        <button
+          type="submit"
+          disabled={loading}
+          className={`${input_styles} bg-[#2B840B] border-[#1E6F01] font-bold text-white hover:bg-[#5D9008] hover:text-white cursor-pointer disabled:opacity-50`}
+        >
+          {loading ? "Please wait..." : token ? "Reset password" : "Send reset link"}
+        </button>
+      </form>
+
+      <p className="text-xl mt-10 text-[#775B2B] font-bold">
+        <Link href="/authentication/login" className="text-[#2B840B]">Back to login</Link>
+      </p>
+    </div>
+  );
+}
+
+export default function ResetPassword() {
+  return (
+    <>
+      <HomeHeader />
+      <main className="min-h-screen mx-20 mt-10">
+        <Suspense>
+          <ResetPasswordForm />
+        </Suspense>
+      </main>
+    </>
+  );
+}
@@ -7,6 +7,7 @@ import Image from "next/image";
 import Modal from "./Modal"
 import {
   getIntakeByDate,
+  ensureIntake,
   addMeal,
   updateMeal,
   deleteMeal,
@@ -62,7 +63,7 @@ export default function IntakeLogsPage() {
       const data = await getIntakeByDate(date);
       if (activeTab === "Yesterday" || activeTab === "2 Days Ago") {
         if (data && !data.is_locked) {
-          await lockIntake(data.di_id);
+          await lockIntake(data.di_id, data.version);
           data.is_locked = true;
         }
       }
@@ -84,9 +85,11 @@ export default function IntakeLogsPage() {
   }, [activeTab]);
 
   const handleAddMeal = async () => {
-    if (!intake?.di_id) return;
+    // The day only gets a row once something is logged on it.
+    const day = intake ?? await ensureIntake(selectedDate);
+    if (!day?.di_id) return;
 
-    await addMeal(intake.di_id, {
+    await addMeal(day.di_id, {
       food_name: mealForm.food_name,
       calories: Number(mealForm.calories),
       time: mealForm.time || undefined,
@@ -111,11 +114,12 @@ export default function IntakeLogsPage() {
   const handleEditMeal = async () => {
     if (editingMealId === null) return;
 
+    const editing = meals.find((m) => m.M_ID === editingMealId);
     await updateMeal(editingMealId, {
       food_name: mealForm.food_name,
       calories: Number(mealForm.calories),
       time: mealForm.time || undefined,
-    });
+    }, editing?.version ?? 0);
 
     setShowEditModal(false);
     setEditingMealId(null);
@@ -175,7 +179,7 @@ export default function IntakeLogsPage() {
               <button
                 onClick={async () => {
                   if (!intake?.di_id) return;
-                  await lockIntake(intake.di_id);
+                  await lockIntake(intake.di_id, intake.version);
                   fetchIntake();
                 }}
                 className="bg-green-600 text-white px-6 py-3 rounded-lg"
@@ -216,7 +220,14 @@ export default function IntakeLogsPage() {
               filteredMeals.map((m, i) => (
                 <tr key={m.M_ID}>
                   <td className="text-center text-md">{i + 1}</td>
-                  <td className="text-center text-md">{m.food_name}</td>
+                  <td className="text-center text-md">
+                    {m.food_name}
+                    {m.comments?.map((c) => (
+                      <p key={c.c_id} className="text-xs text-[#ED9417]">
+                        {c.author?.username || c.nutritionist?.username}: {c.content}
+                      </p>
+                    ))}
+                  </td>
                   <td className="text-center text-md">{m.calories}</td>
                   <td className="text-center text-md">{m.time}</td>
                   <td className="flex items-center justify-center gap-2">
@@ -230,7 +241,7 @@ export default function IntakeLogsPage() {
                     <button
                       disabled={isLocked}
                       className={`${button_styles} ${isLocked ? "bg-gray-400" : "bg-red-600 text-white hover:bg-green-800 transition"}`}
-                      onClick={() => !isLocked && deleteMeal(m.M_ID).then(fetchIntake)}
+                      onClick={() => !isLocked && deleteMeal(m.M_ID, m.version).then(fetchIntake)}
                     >
                       Delete
                     </button>
@@ -244,13 +255,15 @@ export default function IntakeLogsPage() {
         {/* Comments Section */}
         {intake?.comments && intake.comments.length > 0 && (
           <div className="mt-8 mb-10">
-            <h2 className="text-2xl font-bold text-[#774D06] mb-4">Nutritionist Comments</h2>
+            <h2 className="text-2xl font-bold text-[#774D06] mb-4">
+              Comments{intake.unread_comments > 0 && ` (${intake.unread_comments} unread)`}
+            </h2>
             <div className="flex flex-col gap-4">
               {intake.comments.map((comment) => (
                 <div key={comment.c_id} className="bg-white border border-[#B2A48C] rounded-lg p-4 shadow-sm">
                   <div className="flex items-center gap-2 mb-2">
-                    <span className="font-bold text-[#ED9417]">{comment.nutritionist?.username || "Nutritionist"}</span>
-                    <span className="text-sm text-gray-500">commented:</span>
+                    <span className="font-bold text-[#ED9417]">{comment.author?.username || comment.nutritionist?.username || "Nutritionist"}</span>
+                    <span className="text-sm text-gray-500">{comment.parent_id ? "replied:" : "commented:"}</span>
                   </div>
                   <p className="text-[#4A3A1E]">{comment.content}</p>
                 </div>
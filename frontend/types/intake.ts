@@ -3,6 +3,8 @@ export interface Meal {
   food_name: string;
   calories: number;
   time: string;
+  version: number;
+  comments?: Comment[];
 }
 
 export interface Comment {
@@ -10,9 +12,17 @@ export interface Comment {
   content: string;
   nutritionist_id: string;
   di_id: string;
+  parent_id: number | null;
+  meal_id: string | null;
+  author_id: string;
+  author_role: string;
+  created_at: string;
   nutritionist: {
     username: string;
   };
+  author?: {
+    username: string;
+  };
 }
 
 export interface IntakeResponse {
@@ -21,6 +31,8 @@ export interface IntakeResponse {
   total_calories: number;
   is_locked?: boolean;
   user_id?: string;
+  version: number;
+  unread_comments: number;
   meals: Meal[];
   comments: Comment[];
 }
\ No newline at end of file
@@ -1,13 +1,28 @@
 import api from "@/utils/api";
 import type { IntakeResponse, Meal } from "@/types/intake";
 
+// Reads never create a day; a day without a row comes back as null.
+async function getIntake(query: string): Promise<IntakeResponse | null> {
+  try {
+    const res = await api.get(`/intake${query}`);
+    return res.data;
+  } catch (err: any) {
+    if (err.response?.status === 404) return null;
+    throw err;
+  }
+}
+
 export async function getTodayIntake(): Promise<IntakeResponse | null> {
-  const res = await api.get("/intake/today");
-  return res.data;
+  return getIntake("");
 }
 
 export async function getIntakeByDate(date: string): Promise<IntakeResponse | null> {
-  const res = await api.get(`/intake?date=${date}`);
+  return getIntake(`?date=${date}`);
+}
+
+// Creates the day if it does not exist yet, so meals can be added to it.
+export async function ensureIntake(date: string): Promise<IntakeResponse> {
+  const res = await api.put(`/intake/${date}`);
   return res.data;
 }
 
@@ -16,18 +31,21 @@ export async function addMeal(intakeId: string, body: any) {
   return res.data;
 }
 
-export async function updateMeal(mealId: string, body: any) {
-  const res = await api.put(`/intake/meal/${mealId}/edit`, body);
+// Writes send the version they were based on; the server answers 412 if it changed meanwhile.
+const ifMatch = (version: number) => ({ headers: { "If-Match": `"${version}"` } });
+
+export async function updateMeal(mealId: string, body: any, version: number) {
+  const res = await api.put(`/intake/meal/${mealId}/edit`, body, ifMatch(version));
   return res.data;
 }
 
-export async function deleteMeal(mealId: string) {
-  const res = await api.delete(`/intake/meal/${mealId}/delete`);
+export async function deleteMeal(mealId: string, version: number) {
+  const res = await api.delete(`/intake/meal/${mealId}/delete`, ifMatch(version));
   return res.data;
 }
 
-export async function lockIntake(intakeId: string) {
-  const res = await api.patch(`/intake/${intakeId}/lock`)
+export async function lockIntake(intakeId: string, version: number) {
+  const res = await api.patch(`/intake/${intakeId}/lock`, undefined, ifMatch(version))
 }
 
 export type { IntakeResponse, Meal };